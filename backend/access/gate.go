@@ -0,0 +1,131 @@
+package access
+
+import (
+	"context"
+	"crypto/subtle"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Codes of the rejections decided here, matching the services' own error
+// codes.
+const (
+	codeUnauthorized = "unauthorized"
+	codeNotFound     = "not_found"
+	codeRateLimited  = "rate_limited"
+)
+
+// Rejection is an error response decided on by a check in this package,
+// for the service to write in its own error format.
+type Rejection struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{} // nil when there are none
+	Header  http.Header // headers to set on the response
+
+	// LimitedBy is "key" or "ip" when a rate limit rejected the request,
+	// naming the bucket that ran out.
+	LimitedBy string
+}
+
+// Gate admits requests by their API key or, without one, by client IP,
+// each against its own rate limit.
+type Gate struct {
+	// Keys checks the API keys requests carry. Without it keys are not
+	// checked and every request is limited by client IP.
+	Keys *KeyStore
+
+	// Anonymous and PerKey are the rate limits per client IP and per API
+	// key. A nil limiter allows everything.
+	Anonymous, PerKey *Limiter
+
+	// RequireKey rejects requests without a valid API key.
+	RequireKey bool
+
+	// InternalKey is the key the backend services call each other with.
+	// Requests carrying it are neither checked nor limited. Empty disables
+	// it.
+	InternalKey string
+}
+
+// Admit checks key, the API key a request carries or "" for none, and
+// takes a token from the bucket of the key or of clientIP. It returns nil
+// if the request may proceed. The error reports a failed key lookup.
+func (g *Gate) Admit(ctx context.Context, key, clientIP string) (*Rejection, error) {
+	if key != "" && g.InternalKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(g.InternalKey)) == 1 {
+		return nil, nil
+	}
+
+	if key == "" || g.Keys == nil {
+		if g.RequireKey {
+			return unauthorized("an API key is required in the " + APIKeyHeader + " header"), nil
+		}
+		return allow(g.Anonymous, "ip", clientIP), nil
+	}
+
+	keyID, ok := g.Keys.Cached(key)
+	if !ok {
+		// Keys missing from the cache, which include every invalid key, are
+		// looked up in the database. The lookup counts against the client
+		// IP, so guessing keys is limited like any anonymous request.
+		if rejection := allow(g.Anonymous, "ip", clientIP); rejection != nil {
+			return rejection, nil
+		}
+
+		var err error
+		if keyID, err = g.Keys.Lookup(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+	if keyID == 0 {
+		return unauthorized("invalid or revoked API key"), nil
+	}
+
+	return allow(g.PerKey, "key", strconv.Itoa(keyID)), nil
+}
+
+// AuthorizeAdmin checks that r carries token as a bearer token in its
+// Authorization header. An admin API is disabled, and rejects every
+// request with 404, when its token is empty.
+func AuthorizeAdmin(r *http.Request, token string) *Rejection {
+	if token == "" {
+		return &Rejection{Status: http.StatusNotFound, Code: codeNotFound, Message: "admin API is disabled"}
+	}
+
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		return &Rejection{
+			Status:  http.StatusUnauthorized,
+			Code:    codeUnauthorized,
+			Message: "invalid admin token",
+			Header:  http.Header{"Www-Authenticate": {"Bearer"}},
+		}
+	}
+	return nil
+}
+
+// allow takes a token from client's bucket in limiter, and rejects the
+// request with 429 if the bucket is empty.
+func allow(limiter *Limiter, kind, client string) *Rejection {
+	ok, wait := limiter.Allow(client)
+	if ok {
+		return nil
+	}
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	return &Rejection{
+		Status:    http.StatusTooManyRequests,
+		Code:      codeRateLimited,
+		Message:   "rate limit exceeded",
+		Details:   map[string]interface{}{"retry_after_seconds": retryAfter},
+		Header:    http.Header{"Retry-After": {strconv.Itoa(retryAfter)}},
+		LimitedBy: kind,
+	}
+}
+
+func unauthorized(message string) *Rejection {
+	return &Rejection{Status: http.StatusUnauthorized, Code: codeUnauthorized, Message: message}
+}
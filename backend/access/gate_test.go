@@ -0,0 +1,94 @@
+package access
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthorizeAdmin(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		status        int // 0 when the request is authorized
+	}{
+		{"bearer token", "secret", "Bearer secret", 0},
+		{"missing Bearer prefix", "secret", "secret", http.StatusUnauthorized},
+		{"other scheme", "secret", "Basic secret", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer guess", http.StatusUnauthorized},
+		{"no header", "secret", "", http.StatusUnauthorized},
+		{"admin API disabled", "", "Bearer ", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin/keys", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			rejection := AuthorizeAdmin(r, tt.token)
+			status := 0
+			if rejection != nil {
+				status = rejection.Status
+			}
+			if status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+		})
+	}
+}
+
+func TestGateAdmit(t *testing.T) {
+	tests := []struct {
+		name     string
+		gate     Gate
+		keys     []string // keys of consecutive requests from one client IP
+		statuses []int    // 0 when the request is admitted
+	}{
+		{
+			name:     "anonymous requests over the limit",
+			gate:     Gate{Anonymous: NewLimiter(60, 2)},
+			keys:     []string{"", "", ""},
+			statuses: []int{0, 0, http.StatusTooManyRequests},
+		},
+		{
+			name:     "key required",
+			gate:     Gate{RequireKey: true},
+			keys:     []string{""},
+			statuses: []int{http.StatusUnauthorized},
+		},
+		{
+			name:     "internal key is not limited",
+			gate:     Gate{Anonymous: NewLimiter(60, 1), RequireKey: true, InternalKey: "internal"},
+			keys:     []string{"internal", "internal", "internal"},
+			statuses: []int{0, 0, 0},
+		},
+		{
+			name:     "other keys are anonymous without a key store",
+			gate:     Gate{Anonymous: NewLimiter(60, 1), InternalKey: "internal"},
+			keys:     []string{"guess", "guess"},
+			statuses: []int{0, http.StatusTooManyRequests},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, key := range tt.keys {
+				rejection, err := tt.gate.Admit(context.Background(), key, "192.0.2.1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				status := 0
+				if rejection != nil {
+					status = rejection.Status
+				}
+				if status != tt.statuses[i] {
+					t.Errorf("request %d: status = %d, want %d", i+1, status, tt.statuses[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package access
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// APIKeyHeader carries a client's API key.
+const APIKeyHeader = "X-API-Key"
+
+// keyCacheTTL bounds how long a key lookup is reused. Revoking a key
+// through this process takes effect at once; other processes notice within
+// the TTL. Only active keys are cached, so the cache holds at most one
+// entry per issued key however many invalid keys clients send.
+const keyCacheTTL = 30 * time.Second
+
+// ErrKeyNotFound is returned when revoking a key that was never issued.
+var ErrKeyNotFound = errors.New("API key not found")
+
+// Key is a client API key as listed by the admin APIs. Key itself is only
+// set when the key is created; the database keeps its hash.
+type Key struct {
+	KeyID     int        `json:"key_id"`
+	Name      string     `json:"name"`
+	Key       string     `json:"key,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+const keyColumns = `key_id, name, created_at, revoked_at`
+
+// KeyStore keeps client API keys in the api_keys table of the csv
+// database. Both services use the same table, so a key issued through
+// either admin API is accepted by both.
+type KeyStore struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	cache map[string]cachedKey
+}
+
+type cachedKey struct {
+	keyID   int
+	expires time.Time
+}
+
+// NewKeyStore returns a KeyStore on the database holding api_keys.
+func NewKeyStore(db *sql.DB) *KeyStore {
+	return &KeyStore{db: db, cache: map[string]cachedKey{}}
+}
+
+// Cached returns the id of the active key if a lookup of it is cached.
+func (s *KeyStore) Cached(key string) (int, bool) {
+	hash := hashKey(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.cache[hash]
+	if !ok {
+		return 0, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(s.cache, hash)
+		return 0, false
+	}
+	return entry.keyID, true
+}
+
+// Lookup returns the id of the active key, or 0 if the key is unknown or
+// revoked. Active keys are cached.
+func (s *KeyStore) Lookup(ctx context.Context, key string) (int, error) {
+	hash := hashKey(key)
+
+	var keyID int
+	err := s.db.QueryRowContext(ctx, `SELECT key_id FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`, hash).Scan(&keyID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error looking up API key: %w", err)
+	}
+
+	s.mu.Lock()
+	s.cache[hash] = cachedKey{keyID: keyID, expires: time.Now().Add(keyCacheTTL)}
+	s.mu.Unlock()
+
+	return keyID, nil
+}
+
+// List returns every issued key, including revoked keys, newest first.
+func (s *KeyStore) List(ctx context.Context) ([]Key, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+keyColumns+` FROM api_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []Key{}
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning API key row: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Create issues a key for the client called name. The returned Key is the
+// only place the key appears.
+func (s *KeyStore) Create(ctx context.Context, name string) (Key, error) {
+	key := newKey()
+	row := s.db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (name, key_hash)
+		VALUES ($1, $2)
+		RETURNING `+keyColumns, name, hashKey(key))
+
+	created, err := scanKey(row)
+	if err != nil {
+		return Key{}, fmt.Errorf("error creating API key: %w", err)
+	}
+	created.Key = key
+	return created, nil
+}
+
+// Revoke revokes the key with the given id, which keeps working on other
+// processes until their cached lookup expires. Revoked keys are kept for
+// reference, and revoking one again keeps its original revocation time.
+func (s *KeyStore) Revoke(ctx context.Context, keyID int) (Key, error) {
+	var hash string
+	var revoked Key
+	var revokedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE api_keys
+		SET revoked_at = coalesce(revoked_at, now())
+		WHERE key_id = $1
+		RETURNING key_hash, `+keyColumns, keyID).
+		Scan(&hash, &revoked.KeyID, &revoked.Name, &revoked.CreatedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return Key{}, ErrKeyNotFound
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("error revoking API key: %w", err)
+	}
+	revoked.RevokedAt = &revokedAt.Time
+
+	s.mu.Lock()
+	delete(s.cache, hash)
+	s.mu.Unlock()
+
+	return revoked, nil
+}
+
+func scanKey(row interface{ Scan(...interface{}) error }) (Key, error) {
+	var key Key
+	var revokedAt sql.NullTime
+	if err := row.Scan(&key.KeyID, &key.Name, &key.CreatedAt, &revokedAt); err != nil {
+		return Key{}, err
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
+
+// newKey returns a random API key. Only its hash is stored.
+func newKey() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return "btfi_" + hex.EncodeToString(b)
+}
+
+// hashKey returns the hex SHA-256 of key, under which keys are stored and
+// looked up. Keys are random, so an unsalted hash is enough.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,241 @@
+// Package compression negotiates and applies gzip and brotli content
+// coding for the backend services.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content codings, as used in Accept-Encoding and Content-Encoding.
+const (
+	Brotli = "br"
+	Gzip   = "gzip"
+)
+
+// MinSize is the smallest response Handler compresses; below it the
+// coding overhead outweighs the saving.
+const MinSize = 1024
+
+// Negotiate returns the coding to use for a request with the given
+// Accept-Encoding header, preferring brotli, or "" for none.
+func Negotiate(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, q := parseCoding(part)
+		if q <= 0 {
+			continue
+		}
+		if coding == "*" {
+			coding = Brotli
+		}
+		if coding != Brotli && coding != Gzip {
+			continue
+		}
+		if q > bestQ || q == bestQ && coding == Brotli {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+func parseCoding(part string) (string, float64) {
+	coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+	q := 1.0
+	if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return "", 0
+		}
+		q = v
+	}
+	return strings.ToLower(strings.TrimSpace(coding)), q
+}
+
+// encodeBrotliLevel trades some of brotli's ratio for speed: the top
+// levels take seconds on a full GTFS-R feed.
+const encodeBrotliLevel = 7
+
+// Encode compresses data with coding at a high compression level, for
+// bodies that are compressed once and served many times.
+func Encode(coding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch coding {
+	case Brotli:
+		w = brotli.NewWriterLevel(&buf, encodeBrotliLevel)
+	case Gzip:
+		gz, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		w = gz
+	default:
+		return nil, fmt.Errorf("unsupported content coding %q", coding)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("error compressing: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("error compressing: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// WeakETag turns a strong entity tag into a weak one. A compressed body is
+// a different representation, so it must not keep the strong tag of the
+// uncompressed one.
+func WeakETag(h http.Header) {
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+}
+
+var (
+	gzipWriters   = sync.Pool{New: func() any { w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression); return w }}
+	brotliWriters = sync.Pool{New: func() any { return brotli.NewWriterLevel(nil, 4) }}
+)
+
+// Handler compresses the responses of next with the coding the client
+// prefers. Responses that already have a Content-Encoding, have no body or
+// are smaller than MinSize are sent as they are.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		coding := Negotiate(r.Header.Get("Accept-Encoding"))
+		if coding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, coding: coding, status: http.StatusOK}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter buffers the start of a response until it knows whether
+// the response is worth compressing.
+type compressWriter struct {
+	http.ResponseWriter
+	coding string
+	status int
+
+	buf     []byte
+	started bool
+	encoder io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.started {
+		return
+	}
+	w.status = status
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		w.start(false)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.started {
+		if w.encoder != nil {
+			return w.encoder.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= MinSize {
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends what has been written so far, compressing it if the
+// response is being compressed.
+func (w *compressWriter) Flush() {
+	if !w.started {
+		w.start(len(w.buf) >= MinSize)
+	}
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) start(compress bool) error {
+	w.started = true
+	h := w.Header()
+
+	if w.status == http.StatusNotModified {
+		// Match the tag the compressed 200 response carried.
+		WeakETag(h)
+	}
+
+	if compress && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", w.coding)
+		h.Del("Content-Length")
+		WeakETag(h)
+		w.encoder = w.newEncoder()
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.encoder != nil {
+		_, err := w.encoder.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+func (w *compressWriter) newEncoder() io.WriteCloser {
+	if w.coding == Brotli {
+		bw := brotliWriters.Get().(*brotli.Writer)
+		bw.Reset(w.ResponseWriter)
+		return bw
+	}
+	gw := gzipWriters.Get().(*gzip.Writer)
+	gw.Reset(w.ResponseWriter)
+	return gw
+}
+
+func (w *compressWriter) close() {
+	if !w.started {
+		w.start(false)
+	}
+	if w.encoder == nil {
+		return
+	}
+
+	w.encoder.Close()
+	switch encoder := w.encoder.(type) {
+	case *brotli.Writer:
+		brotliWriters.Put(encoder)
+	case *gzip.Writer:
+		gzipWriters.Put(encoder)
+	}
+}
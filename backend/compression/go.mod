@@ -0,0 +1,5 @@
+module github.com/evanhearne/better_tfi/backend/compression
+
+go 1.23.2
+
+require github.com/andybalholm/brotli v1.1.1
@@ -0,0 +1,277 @@
+// Package config loads the runtime configuration shared by the backend
+// services.
+//
+// Each setting has a snake_case key and is resolved, from lowest to highest
+// precedence, from its default, a YAML or TOML config file, an environment
+// variable and a command-line flag. For a service with prefix "gtfsr" the
+// setting "api_key" is read from the "api_key" key of the file, the
+// GTFSR_API_KEY environment variable and the -api-key flag. The file is
+// named by the -config flag or the GTFSR_CONFIG environment variable.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Loader collects setting definitions and resolves them with Load.
+type Loader struct {
+	prefix   string
+	args     []string
+	settings []*setting
+}
+
+type setting struct {
+	key      string
+	usage    string
+	fallback string
+	required bool
+	secret   bool
+	parse    func(string) error
+	flag     *string
+	value    string
+	source   string
+}
+
+// New returns a Loader for the service identified by prefix, reading flags
+// from args (usually os.Args[1:]).
+func New(prefix string, args []string) *Loader {
+	return &Loader{prefix: prefix, args: args}
+}
+
+// Option adjusts a setting definition.
+type Option func(*setting)
+
+// Required makes Load fail when the setting resolves to an empty value.
+func Required() Option {
+	return func(s *setting) { s.required = true }
+}
+
+// Secret keeps the setting's value out of Summary.
+func Secret() Option {
+	return func(s *setting) { s.secret = true }
+}
+
+// String defines a string setting.
+func (l *Loader) String(key, fallback, usage string, options ...Option) *string {
+	value := new(string)
+	l.define(key, fallback, usage, options, func(raw string) error {
+		*value = raw
+		return nil
+	})
+	return value
+}
+
+// URL defines a setting holding an absolute http or https URL. An empty
+// value is allowed unless the setting is Required.
+func (l *Loader) URL(key, fallback, usage string, options ...Option) *string {
+	value := new(string)
+	l.define(key, fallback, usage, options, func(raw string) error {
+		if raw == "" {
+			*value = raw
+			return nil
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%q is not an http or https URL", raw)
+		}
+		*value = raw
+		return nil
+	})
+	return value
+}
+
+// Int defines an integer setting.
+func (l *Loader) Int(key string, fallback int, usage string, options ...Option) *int {
+	value := new(int)
+	l.define(key, strconv.Itoa(fallback), usage, options, func(raw string) error {
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		*value = v
+		return nil
+	})
+	return value
+}
+
+// Bool defines a boolean setting.
+func (l *Loader) Bool(key string, fallback bool, usage string, options ...Option) *bool {
+	value := new(bool)
+	l.define(key, strconv.FormatBool(fallback), usage, options, func(raw string) error {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		*value = v
+		return nil
+	})
+	return value
+}
+
+// Duration defines a duration setting such as "20s" or "5m".
+func (l *Loader) Duration(key string, fallback time.Duration, usage string, options ...Option) *time.Duration {
+	value := new(time.Duration)
+	l.define(key, fallback.String(), usage, options, func(raw string) error {
+		v, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", raw)
+		}
+		if v < 0 {
+			return fmt.Errorf("%q must not be negative", raw)
+		}
+		*value = v
+		return nil
+	})
+	return value
+}
+
+func (l *Loader) define(key, fallback, usage string, options []Option, parse func(string) error) {
+	s := &setting{key: key, usage: usage, fallback: fallback, parse: parse}
+	for _, option := range options {
+		option(s)
+	}
+	l.settings = append(l.settings, s)
+}
+
+// Load resolves every defined setting. It reports all invalid and missing
+// settings at once, naming where each bad value came from. It returns
+// flag.ErrHelp after printing the usage when -h or -help is given.
+func (l *Loader) Load() error {
+	flags := flag.NewFlagSet(l.prefix, flag.ContinueOnError)
+	configPath := flags.String("config", "", "path to a YAML or TOML config file (env "+l.envName("config")+")")
+	for _, s := range l.settings {
+		s.flag = flags.String(flagName(s.key), "", fmt.Sprintf("%s (env %s, default %q)", s.usage, l.envName(s.key), s.fallback))
+	}
+	if err := flags.Parse(l.args); err != nil {
+		return err
+	}
+
+	setFlags := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	if *configPath == "" {
+		*configPath = os.Getenv(l.envName("config"))
+	}
+
+	file := map[string]string{}
+	if *configPath != "" {
+		var err error
+		if file, err = readFile(*configPath); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	for key := range file {
+		if l.lookup(key) == nil {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", *configPath, key))
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+
+	for _, s := range l.settings {
+		raw, source := s.fallback, "default"
+		if v, ok := file[s.key]; ok {
+			raw, source = v, *configPath
+		}
+		if v, ok := os.LookupEnv(l.envName(s.key)); ok {
+			raw, source = v, "env "+l.envName(s.key)
+		}
+		if setFlags[flagName(s.key)] {
+			raw, source = *s.flag, "flag -"+flagName(s.key)
+		}
+		s.value, s.source = raw, source
+
+		if s.required && strings.TrimSpace(raw) == "" {
+			errs = append(errs, fmt.Errorf("%s is required: set %s, -%s or %q in the config file",
+				s.key, l.envName(s.key), flagName(s.key), s.key))
+			continue
+		}
+		if err := s.parse(raw); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s from %s: %w", s.key, source, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid %s configuration: %w", l.prefix, errors.Join(errs...))
+	}
+	return nil
+}
+
+// Summary describes where each setting came from, with secrets masked, for
+// logging at startup.
+func (l *Loader) Summary() string {
+	var parts []string
+	for _, s := range l.settings {
+		if s.secret {
+			parts = append(parts, fmt.Sprintf("%s=<redacted> (%s)", s.key, s.source))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s (%s)", s.key, s.value, s.source))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (l *Loader) lookup(key string) *setting {
+	for _, s := range l.settings {
+		if s.key == key {
+			return s
+		}
+	}
+	return nil
+}
+
+func (l *Loader) envName(key string) string {
+	return strings.ToUpper(l.prefix + "_" + key)
+}
+
+func flagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// readFile reads a flat YAML or TOML file, chosen by extension, into raw
+// string values.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	var values map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	file := map[string]string{}
+	for key, value := range values {
+		switch v := value.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("%s: setting %q must be a single value", path, key)
+		case nil:
+			file[key] = ""
+		default:
+			file[key] = fmt.Sprint(v)
+		}
+	}
+	return file, nil
+}
@@ -0,0 +1,147 @@
+// Package cors answers cross-origin requests for the backend services, so
+// the web build of the app can call them from another origin.
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// allowedHeaders are the request headers the services read that browsers
+// only send cross-origin after a preflight.
+var allowedHeaders = []string{"Authorization", "Content-Type", "If-Modified-Since", "If-None-Match", "X-API-Key", "X-Request-ID"}
+
+// exposedHeaders are the response headers scripts may read besides the
+// CORS-safelisted ones.
+var exposedHeaders = []string{"ETag", "Retry-After", "X-Request-ID"}
+
+// Policy decides which origins may call a service and how.
+type Policy struct {
+	anyOrigin bool
+	origins   map[string]bool
+	methods   string
+	maxAge    string
+}
+
+// New returns a Policy allowing origins to use methods, with preflight
+// results cached by browsers for maxAge. An origin of "*" allows every
+// origin. It returns nil, which allows no cross-origin requests, when
+// origins is empty.
+func New(origins, methods []string, maxAge time.Duration) *Policy {
+	if len(origins) == 0 {
+		return nil
+	}
+
+	p := &Policy{
+		origins: map[string]bool{},
+		methods: strings.Join(methods, ", "),
+		maxAge:  strconv.Itoa(int(maxAge.Seconds())),
+	}
+	for _, origin := range origins {
+		if origin == "*" {
+			p.anyOrigin = true
+		}
+		p.origins[origin] = true
+	}
+	return p
+}
+
+// ParseOrigins parses a comma-separated list of origins such as
+// "https://app.example.com", or "*" for any origin.
+func ParseOrigins(list string) ([]string, error) {
+	var origins []string
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			origins = append(origins, entry)
+			continue
+		}
+		u, err := url.Parse(entry)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			strings.TrimSuffix(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+			return nil, fmt.Errorf("%q is not an origin such as https://app.example.com", entry)
+		}
+		origins = append(origins, strings.ToLower(u.Scheme+"://"+u.Host))
+	}
+	return origins, nil
+}
+
+// ParseMethods parses a comma-separated list of HTTP methods.
+func ParseMethods(list string) ([]string, error) {
+	var methods []string
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.ToUpper(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if strings.Trim(entry, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return nil, fmt.Errorf("%q is not an HTTP method", entry)
+		}
+		methods = append(methods, entry)
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("at least one method is required")
+	}
+	return methods, nil
+}
+
+// Apply sets the CORS response headers for r. It reports whether r is a
+// preflight request from an allowed origin, which the caller should
+// answer with 204 No Content instead of passing it on.
+func (p *Policy) Apply(w http.ResponseWriter, r *http.Request) bool {
+	if p == nil {
+		return false
+	}
+
+	h := w.Header()
+	if !p.anyOrigin {
+		h.Add("Vary", "Origin")
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || !p.allows(origin) {
+		return false
+	}
+
+	if p.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		h.Set("Access-Control-Expose-Headers", strings.Join(exposedHeaders, ", "))
+		return false
+	}
+
+	h.Set("Access-Control-Allow-Methods", p.methods)
+	h.Set("Access-Control-Allow-Headers", strings.Join(allowedHeaders, ", "))
+	h.Set("Access-Control-Max-Age", p.maxAge)
+	return true
+}
+
+func (p *Policy) allows(origin string) bool {
+	return p.anyOrigin || p.origins[strings.ToLower(origin)]
+}
+
+// Handler applies p to every request and answers preflight requests
+// itself, without calling next.
+func (p *Policy) Handler(next http.Handler) http.Handler {
+	if p == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.Apply(w, r) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
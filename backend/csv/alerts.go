@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// customAlert is an alert written by an operator through the admin API,
+// for disruptions known before the official feed carries them.
+type customAlert struct {
+	AlertID         int        `json:"alert_id"`
+	HeaderText      string     `json:"header_text" binding:"required"`
+	DescriptionText string     `json:"description_text"`
+	URL             string     `json:"url"`
+	Cause           string     `json:"cause"`
+	Effect          string     `json:"effect"`
+	RouteIDs        []string   `json:"route_ids"`
+	StopIDs         []string   `json:"stop_ids"`
+	ActiveStart     *time.Time `json:"active_start"`
+	ActiveEnd       *time.Time `json:"active_end"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+const customAlertColumns = `alert_id, header_text, description_text, url, cause, effect, route_ids, stop_ids, active_start, active_end, created_at, updated_at`
+
+// getAlerts handles /alerts?route_id=&stop_id= and returns the official
+// alerts from the gtfsr service merged with active custom alerts, as a
+// GTFS-Realtime JSON feed. Custom alerts are matched by the same rule as the
+// official ones: an alert with no route_ids applies to every route, and one
+// with no stop_ids to every stop.
+func getAlerts(c *gin.Context) {
+	ctx := c.Request.Context()
+	routeID, stopID := c.Query("route_id"), c.Query("stop_id")
+
+	feed, err := fetchOfficialAlerts(ctx, routeID, stopID)
+	if err != nil {
+		// Custom alerts are still worth serving when the feed is down.
+		slog.WarnContext(ctx, "error fetching official alerts", "error", err)
+		feed = map[string]interface{}{}
+	}
+
+	entities, _ := feed["entity"].([]interface{})
+	if entities == nil {
+		entities = []interface{}{}
+	}
+
+	alerts, err := getActiveCustomAlerts(ctx, routeID, stopID)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	for _, alert := range alerts {
+		entities = append(entities, alert.toFeedEntity())
+	}
+	feed["entity"] = entities
+
+	c.JSON(http.StatusOK, feed)
+}
+
+func fetchOfficialAlerts(ctx context.Context, routeID, stopID string) (map[string]interface{}, error) {
+	if cfg.GtfsrURL == "" {
+		return map[string]interface{}{}, nil
+	}
+
+	query := url.Values{}
+	if routeID != "" {
+		query.Set("route_id", routeID)
+	}
+	if stopID != "" {
+		query.Set("stop_id", stopID)
+	}
+
+	resp, err := gtfsrGet(ctx, "/alerts?"+query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("error fetching alerts: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received non-200 response from gtfsr service: %d", resp.StatusCode)
+	}
+
+	var feed map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("error decoding alerts: %w", err)
+	}
+	return feed, nil
+}
+
+func getActiveCustomAlerts(ctx context.Context, routeID, stopID string) ([]customAlert, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+customAlertColumns+`
+		FROM custom_alerts
+		WHERE (active_start IS NULL OR active_start <= now())
+		AND (active_end IS NULL OR active_end > now())
+		AND ($1 = '' OR cardinality(route_ids) = 0 OR $1 = ANY(route_ids))
+		AND ($2 = '' OR cardinality(stop_ids) = 0 OR $2 = ANY(stop_ids))
+		ORDER BY created_at DESC
+	`, routeID, stopID)
+
+	if err != nil {
+		return nil, fmt.Errorf("error querying custom alerts: %w", err)
+	}
+	defer rows.Close()
+
+	return scanCustomAlerts(rows)
+}
+
+func scanCustomAlerts(rows *sql.Rows) ([]customAlert, error) {
+	alerts := []customAlert{}
+	for rows.Next() {
+		alert, err := scanCustomAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+func scanCustomAlert(row interface{ Scan(...interface{}) error }) (customAlert, error) {
+	var alert customAlert
+	var descriptionText, alertURL, cause, effect sql.NullString
+	var activeStart, activeEnd sql.NullTime
+	var routeIDs, stopIDs pq.StringArray
+
+	if err := row.Scan(&alert.AlertID, &alert.HeaderText, &descriptionText, &alertURL, &cause, &effect,
+		&routeIDs, &stopIDs, &activeStart, &activeEnd, &alert.CreatedAt, &alert.UpdatedAt); err != nil {
+		return customAlert{}, err
+	}
+
+	alert.DescriptionText = descriptionText.String
+	alert.URL = alertURL.String
+	alert.Cause = cause.String
+	alert.Effect = effect.String
+	alert.RouteIDs = routeIDs
+	alert.StopIDs = stopIDs
+	if activeStart.Valid {
+		alert.ActiveStart = &activeStart.Time
+	}
+	if activeEnd.Valid {
+		alert.ActiveEnd = &activeEnd.Time
+	}
+	return alert, nil
+}
+
+// toFeedEntity converts the alert into a GTFS-Realtime JSON feed entity so
+// it can sit alongside the official alerts. An alert with both route_ids and
+// stop_ids informs each route at each of the stops.
+func (a customAlert) toFeedEntity() gin.H {
+	informedEntities := []gin.H{}
+	switch {
+	case len(a.StopIDs) == 0:
+		for _, routeID := range a.RouteIDs {
+			informedEntities = append(informedEntities, gin.H{"route_id": routeID})
+		}
+	case len(a.RouteIDs) == 0:
+		for _, stopID := range a.StopIDs {
+			informedEntities = append(informedEntities, gin.H{"stop_id": stopID})
+		}
+	default:
+		for _, routeID := range a.RouteIDs {
+			for _, stopID := range a.StopIDs {
+				informedEntities = append(informedEntities, gin.H{"route_id": routeID, "stop_id": stopID})
+			}
+		}
+	}
+
+	alert := gin.H{
+		"informed_entity": informedEntities,
+		"header_text":     translated(a.HeaderText),
+	}
+	if a.DescriptionText != "" {
+		alert["description_text"] = translated(a.DescriptionText)
+	}
+	if a.URL != "" {
+		alert["url"] = translated(a.URL)
+	}
+	if a.Cause != "" {
+		alert["cause"] = a.Cause
+	}
+	if a.Effect != "" {
+		alert["effect"] = a.Effect
+	}
+	if a.ActiveStart != nil || a.ActiveEnd != nil {
+		period := gin.H{}
+		if a.ActiveStart != nil {
+			period["start"] = a.ActiveStart.Unix()
+		}
+		if a.ActiveEnd != nil {
+			period["end"] = a.ActiveEnd.Unix()
+		}
+		alert["active_period"] = []gin.H{period}
+	}
+
+	return gin.H{
+		"id":    "custom-" + strconv.Itoa(a.AlertID),
+		"alert": alert,
+	}
+}
+
+func translated(text string) gin.H {
+	return gin.H{"translation": []gin.H{{"text": text, "language": "en"}}}
+}
+
+// listCustomAlerts handles GET /admin/alerts, including expired alerts.
+func listCustomAlerts(c *gin.Context) {
+	ctx := c.Request.Context()
+	rows, err := db.QueryContext(ctx, `SELECT `+customAlertColumns+` FROM custom_alerts ORDER BY created_at DESC`)
+	if err != nil {
+		internalError(c, codeDatabaseError, fmt.Errorf("error querying custom alerts: %w", err))
+		return
+	}
+	defer rows.Close()
+
+	alerts, err := scanCustomAlerts(rows)
+	if err != nil {
+		internalError(c, codeDatabaseError, fmt.Errorf("error scanning custom alert row: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alerts": alerts})
+}
+
+// createCustomAlert handles POST /admin/alerts.
+func createCustomAlert(c *gin.Context) {
+	ctx := c.Request.Context()
+	var alert customAlert
+	if err := bindCustomAlert(c, &alert); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	row := db.QueryRowContext(ctx, `
+		INSERT INTO custom_alerts (header_text, description_text, url, cause, effect, route_ids, stop_ids, active_start, active_end)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+customAlertColumns,
+		alert.HeaderText, alert.DescriptionText, alert.URL, alert.Cause, alert.Effect,
+		pq.Array(alert.RouteIDs), pq.Array(alert.StopIDs), alert.ActiveStart, alert.ActiveEnd)
+
+	created, err := scanCustomAlert(row)
+	if err != nil {
+		internalError(c, codeDatabaseError, fmt.Errorf("error creating custom alert: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// updateCustomAlert handles PUT /admin/alerts/:alert_id, replacing every
+// editable field of the alert.
+func updateCustomAlert(c *gin.Context) {
+	ctx := c.Request.Context()
+	alertID, err := strconv.Atoi(c.Param("alert_id"))
+	if err != nil {
+		badRequest(c, invalidParam("alert_id", "alert_id must be an integer"))
+		return
+	}
+
+	var alert customAlert
+	if err := bindCustomAlert(c, &alert); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	row := db.QueryRowContext(ctx, `
+		UPDATE custom_alerts
+		SET header_text = $2, description_text = $3, url = $4, cause = $5, effect = $6,
+			route_ids = $7, stop_ids = $8, active_start = $9, active_end = $10, updated_at = now()
+		WHERE alert_id = $1
+		RETURNING `+customAlertColumns,
+		alertID, alert.HeaderText, alert.DescriptionText, alert.URL, alert.Cause, alert.Effect,
+		pq.Array(alert.RouteIDs), pq.Array(alert.StopIDs), alert.ActiveStart, alert.ActiveEnd)
+
+	updated, err := scanCustomAlert(row)
+	if err == sql.ErrNoRows {
+		notFound(c, "alert not found")
+		return
+	}
+	if err != nil {
+		internalError(c, codeDatabaseError, fmt.Errorf("error updating custom alert: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// expireCustomAlert handles POST /admin/alerts/:alert_id/expire, ending
+// the alert's active period now, or keeping its end if that has already
+// passed. Expired alerts are kept for reference.
+func expireCustomAlert(c *gin.Context) {
+	ctx := c.Request.Context()
+	alertID, err := strconv.Atoi(c.Param("alert_id"))
+	if err != nil {
+		badRequest(c, invalidParam("alert_id", "alert_id must be an integer"))
+		return
+	}
+
+	row := db.QueryRowContext(ctx, `
+		UPDATE custom_alerts
+		SET active_end = least(coalesce(active_end, now()), now()), updated_at = now()
+		WHERE alert_id = $1
+		RETURNING `+customAlertColumns, alertID)
+
+	expired, err := scanCustomAlert(row)
+	if err == sql.ErrNoRows {
+		notFound(c, "alert not found")
+		return
+	}
+	if err != nil {
+		internalError(c, codeDatabaseError, fmt.Errorf("error expiring custom alert: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, expired)
+}
+
+func bindCustomAlert(c *gin.Context, alert *customAlert) error {
+	if err := c.ShouldBindJSON(alert); err != nil {
+		return fmt.Errorf("invalid alert: %w", err)
+	}
+	if len(alert.RouteIDs) == 0 && len(alert.StopIDs) == 0 {
+		return fmt.Errorf("alert must target at least one route_id or stop_id")
+	}
+	if alert.ActiveStart != nil && alert.ActiveEnd != nil && !alert.ActiveEnd.After(*alert.ActiveStart) {
+		return fmt.Errorf("active_end must be after active_start")
+	}
+
+	// A missing list binds as NULL, which the NOT NULL array columns reject.
+	if alert.RouteIDs == nil {
+		alert.RouteIDs = []string{}
+	}
+	if alert.StopIDs == nil {
+		alert.StopIDs = []string{}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+func TestBindCustomAlert(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantErr  bool
+		routeIDs string
+		stopIDs  string
+	}{
+		{
+			name:     "routes without stop_ids",
+			body:     `{"header_text": "Diversion", "route_ids": ["r1"]}`,
+			routeIDs: `{"r1"}`,
+			stopIDs:  `{}`,
+		},
+		{
+			name:     "stops without route_ids",
+			body:     `{"header_text": "Stop closed", "stop_ids": ["s1", "s2"]}`,
+			routeIDs: `{}`,
+			stopIDs:  `{"s1","s2"}`,
+		},
+		{
+			name:    "no routes or stops",
+			body:    `{"header_text": "Diversion"}`,
+			wantErr: true,
+		},
+		{
+			name:    "missing header_text",
+			body:    `{"route_ids": ["r1"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "end before start",
+			body:    `{"header_text": "Diversion", "route_ids": ["r1"], "active_start": "2024-06-02T00:00:00Z", "active_end": "2024-06-01T00:00:00Z"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/admin/alerts", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			var alert customAlert
+			err := bindCustomAlert(c, &alert)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The lists are bound as they are passed to the database, where
+			// NULL would violate the columns' NOT NULL constraint.
+			for _, list := range []struct {
+				name   string
+				values []string
+				want   string
+			}{
+				{"route_ids", alert.RouteIDs, tt.routeIDs},
+				{"stop_ids", alert.StopIDs, tt.stopIDs},
+			} {
+				value, err := pq.Array(list.values).Value()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if value != list.want {
+					t.Errorf("%s bound as %v, want %s", list.name, value, list.want)
+				}
+			}
+		})
+	}
+}
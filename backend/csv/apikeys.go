@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/evanhearne/better_tfi/backend/access"
+	"github.com/gin-gonic/gin"
+)
+
+// gate admits requests by API key or client IP, set up in main. Its zero
+// value checks no keys and limits nothing.
+var gate access.Gate
+
+// rateLimit rejects requests without a valid API key when one is required,
+// and requests over the client's rate limit with 429. Health, metrics and
+// admin endpoints are not limited.
+func rateLimit(c *gin.Context) {
+	path := c.Request.URL.Path
+	if path == "/healthz" || path == "/readyz" || path == "/metrics" || strings.HasPrefix(path, "/admin/") {
+		c.Next()
+		return
+	}
+
+	rejection, err := gate.Admit(c.Request.Context(), c.GetHeader(access.APIKeyHeader), c.ClientIP())
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+	if rejection != nil {
+		reject(c, rejection)
+		return
+	}
+
+	c.Next()
+}
+
+// requireAdmin rejects requests without the configured admin token as a
+// bearer token. The admin API is disabled when no token is configured.
+func requireAdmin(c *gin.Context) {
+	if rejection := access.AuthorizeAdmin(c.Request, cfg.AdminToken); rejection != nil {
+		reject(c, rejection)
+		return
+	}
+
+	c.Next()
+}
+
+// reject answers with a rejection decided on by the access package.
+func reject(c *gin.Context, rejection *access.Rejection) {
+	for name, values := range rejection.Header {
+		c.Header(name, values[0])
+	}
+	if rejection.LimitedBy != "" {
+		rateLimited.WithLabelValues(rejection.LimitedBy).Inc()
+	}
+	respondError(c, rejection.Status, rejection.Code, rejection.Message, rejection.Details)
+}
+
+// listAPIKeys handles GET /admin/keys, including revoked keys.
+func listAPIKeys(c *gin.Context) {
+	keys, err := gate.Keys.List(c.Request.Context())
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// createAPIKey handles POST /admin/keys, issuing a key for the client
+// named in the body. The response is the only place the key appears.
+func createAPIKey(c *gin.Context) {
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		badRequest(c, fmt.Errorf("invalid API key request: %w", err))
+		return
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		badRequest(c, errors.New("name must not be empty"))
+		return
+	}
+
+	created, err := gate.Keys.Create(c.Request.Context(), name)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// revokeAPIKey handles POST /admin/keys/:key_id/revoke. Revoked keys are
+// kept for reference.
+func revokeAPIKey(c *gin.Context) {
+	keyID, err := strconv.Atoi(c.Param("key_id"))
+	if err != nil {
+		badRequest(c, invalidParam("key_id", "key_id must be an integer"))
+		return
+	}
+
+	revoked, err := gate.Keys.Revoke(c.Request.Context(), keyID)
+	if errors.Is(err, access.ErrKeyNotFound) {
+		notFound(c, "API key not found")
+		return
+	}
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, revoked)
+}
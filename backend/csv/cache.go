@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/evanhearne/better_tfi/backend/httpcache"
+	"github.com/gin-gonic/gin"
+)
+
+// feedVersionTTL is how often the loaded feed version is re-read, so a
+// reloaded database changes the ETags within a minute.
+const feedVersionTTL = time.Minute
+
+var feedVersion = struct {
+	sync.Mutex
+	version string
+	checked time.Time
+}{}
+
+// currentFeedVersion returns the version of the loaded static feed.
+func currentFeedVersion(ctx context.Context) (string, error) {
+	feedVersion.Lock()
+	defer feedVersion.Unlock()
+
+	if feedVersion.version != "" && time.Since(feedVersion.checked) < feedVersionTTL {
+		return feedVersion.version, nil
+	}
+
+	feed, err := getFeedInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+	feedVersion.version = feed["feed_version"].(string)
+	feedVersion.checked = time.Now()
+	return feedVersion.version, nil
+}
+
+// cacheForFeed marks responses that depend only on the static feed as
+// cacheable for cache_max_age and answers 304 while the feed is unchanged.
+func cacheForFeed(c *gin.Context) {
+	checkFeedCache(c, "", httpcache.MaxAge(cfg.CacheMaxAge))
+}
+
+// cacheForFeedDay is cacheForFeed for responses that also depend on the
+// service date returned by day. Their ETag changes with the date, and
+// caches must revalidate them before reuse.
+func cacheForFeedDay(day func(ctx context.Context) (string, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		date, err := day(c.Request.Context())
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "error getting service date for ETag", "error", err)
+			c.Next()
+			return
+		}
+		checkFeedCache(c, date, httpcache.Revalidate)
+	}
+}
+
+func checkFeedCache(c *gin.Context, date, cacheControl string) {
+	version, err := currentFeedVersion(c.Request.Context())
+	if err != nil {
+		// Serve the response uncached rather than fail the request.
+		slog.WarnContext(c.Request.Context(), "error getting feed version for ETag", "error", err)
+		c.Next()
+		return
+	}
+
+	etag := httpcache.ETag(version)
+	if date != "" {
+		etag = httpcache.ETag(version, date)
+	}
+
+	if httpcache.Check(c.Writer.Header(), c.Request, etag, time.Time{}, cacheControl) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+	c.Next()
+}
+
+// dublinDate is the service date getCurrentDateAndTimeInfo uses.
+func dublinDate(ctx context.Context) (string, error) {
+	date, _, _ := getCurrentDateAndTimeInfo()
+	return date, nil
+}
+
+// databaseDate is the service date getCurrentDateFromDB uses.
+func databaseDate(ctx context.Context) (string, error) {
+	date, err := getCurrentDateFromDB(ctx)
+	if err != nil {
+		return "", err
+	}
+	return date.Format("20060102"), nil
+}
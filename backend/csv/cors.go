@@ -0,0 +1,18 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// allowCORS applies the configured CORS policy and answers preflight
+// requests before they reach rate limiting, since browsers send them
+// without the X-API-Key header.
+func allowCORS(c *gin.Context) {
+	if cfg.CORS.Apply(c.Writer, c.Request) {
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	c.Next()
+}
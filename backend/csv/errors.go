@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/evanhearne/better_tfi/backend/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// Codes in the code field of error responses. Clients may switch on them;
+// messages are for people and may change.
+const (
+	codeInvalidParameter = "invalid_parameter"
+	codeInvalidRequest   = "invalid_request"
+	codeNotFound         = "not_found"
+	codeUnauthorized     = "unauthorized"
+	codeRateLimited      = "rate_limited"
+	codeDatabaseError    = "database_error"
+	codeInternalError    = "internal_error"
+	codeUnavailable      = "unavailable"
+)
+
+// apiError is the body of every error response.
+type apiError struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// errNotFound is wrapped by helpers when the requested route, stop or trip
+// does not exist, so handlers can answer 404.
+var errNotFound = errors.New("not found")
+
+// paramError reports a missing or invalid query or path parameter.
+type paramError struct {
+	param   string
+	message string
+}
+
+func (e *paramError) Error() string {
+	return e.message
+}
+
+func invalidParam(param, message string) error {
+	return &paramError{param: param, message: message}
+}
+
+func respondError(c *gin.Context, status int, code, message string, details interface{}) {
+	// Caching headers set for a successful response do not apply.
+	c.Writer.Header().Del("ETag")
+	c.Writer.Header().Del("Cache-Control")
+
+	c.AbortWithStatusJSON(status, apiError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: logging.RequestID(c.Request.Context()),
+	})
+}
+
+// badRequest responds 400 with err's message. Parameter errors name the
+// parameter in details.
+func badRequest(c *gin.Context, err error) {
+	var pe *paramError
+	if errors.As(err, &pe) {
+		respondError(c, http.StatusBadRequest, codeInvalidParameter, pe.message, gin.H{"parameter": pe.param})
+		return
+	}
+	respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error(), nil)
+}
+
+func notFound(c *gin.Context, message string) {
+	respondError(c, http.StatusNotFound, codeNotFound, message, nil)
+}
+
+// internalError logs err and responds 500 with only a stable error code and
+// the request ID, so database errors are not exposed to clients but can be
+// found in the logs.
+func internalError(c *gin.Context, code string, err error) {
+	slog.ErrorContext(c.Request.Context(), "request failed", "code", code, "error", err)
+	respondError(c, http.StatusInternalServerError, code, "internal server error", nil)
+}
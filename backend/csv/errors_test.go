@@ -0,0 +1,225 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/evanhearne/better_tfi/backend/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// stubQueryErr is returned by every query on the stub database when set.
+// Otherwise every query returns no rows.
+var stubQueryErr error
+
+func TestMain(m *testing.M) {
+	sql.Register("stub", stubDriver{})
+
+	var err error
+	db, err = sql.Open("stub", "")
+	if err != nil {
+		panic(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+func TestErrorResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		dbErr   error
+		status  int
+		code    string
+		details map[string]interface{}
+	}{
+		{
+			name:    "invalid lat",
+			path:    "/nearestStops?lat=north&lng=-6.26",
+			status:  http.StatusBadRequest,
+			code:    codeInvalidParameter,
+			details: map[string]interface{}{"parameter": "lat"},
+		},
+		{
+			name:    "invalid lng",
+			path:    "/nearestStops?lat=53.35&lng=",
+			status:  http.StatusBadRequest,
+			code:    codeInvalidParameter,
+			details: map[string]interface{}{"parameter": "lng"},
+		},
+		{
+			name:    "missing search_query",
+			path:    "/routes",
+			status:  http.StatusBadRequest,
+			code:    codeInvalidParameter,
+			details: map[string]interface{}{"parameter": "search_query"},
+		},
+		{
+			name:    "missing route_id",
+			path:    "/timetable",
+			status:  http.StatusBadRequest,
+			code:    codeInvalidParameter,
+			details: map[string]interface{}{"parameter": "route_id"},
+		},
+		{
+			name:   "unknown timetable route",
+			path:   "/timetable?route_id=no-such-route",
+			status: http.StatusNotFound,
+			code:   codeNotFound,
+		},
+		{
+			name:   "unknown route",
+			path:   "/routes/no-such-route/stops",
+			status: http.StatusNotFound,
+			code:   codeNotFound,
+		},
+		{
+			name:   "unknown stop",
+			path:   "/stops/no-such-stop",
+			status: http.StatusNotFound,
+			code:   codeNotFound,
+		},
+		{
+			name:   "unknown trip",
+			path:   "/trips/no-such-trip",
+			status: http.StatusNotFound,
+			code:   codeNotFound,
+		},
+		{
+			name:   "unknown endpoint",
+			path:   "/no-such-endpoint",
+			status: http.StatusNotFound,
+			code:   codeNotFound,
+		},
+		{
+			name:   "database error",
+			path:   "/trips/1001",
+			dbErr:  errors.New("connection refused"),
+			status: http.StatusInternalServerError,
+			code:   codeDatabaseError,
+		},
+		{
+			name:    "database not ready",
+			path:    "/readyz",
+			dbErr:   errors.New("connection refused"),
+			status:  http.StatusServiceUnavailable,
+			code:    codeUnavailable,
+			details: map[string]interface{}{"database": "ok", "feed": "unavailable"},
+		},
+	}
+
+	router, err := newRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubQueryErr = tt.dbErr
+			defer func() { stubQueryErr = nil }()
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(logging.RequestIDHeader, "test-request")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+
+			var body struct {
+				Code      string                 `json:"code"`
+				Message   string                 `json:"message"`
+				Details   map[string]interface{} `json:"details"`
+				RequestID string                 `json:"request_id"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("error decoding body %q: %v", rec.Body.String(), err)
+			}
+
+			if body.Code != tt.code {
+				t.Errorf("code = %q, want %q", body.Code, tt.code)
+			}
+			if body.Message == "" {
+				t.Error("message is empty")
+			}
+			if !reflect.DeepEqual(body.Details, tt.details) {
+				t.Errorf("details = %v, want %v", body.Details, tt.details)
+			}
+			if body.RequestID != "test-request" {
+				t.Errorf("request_id = %q, want %q", body.RequestID, "test-request")
+			}
+		})
+	}
+}
+
+// stubDriver is a database/sql driver standing in for Postgres. Queries
+// return no rows, or fail with stubQueryErr.
+type stubDriver struct{}
+
+func (stubDriver) Open(name string) (driver.Conn, error) {
+	return stubConn{}, nil
+}
+
+type stubConn struct{}
+
+func (stubConn) Prepare(query string) (driver.Stmt, error) {
+	return stubStmt{}, nil
+}
+
+func (stubConn) Close() error {
+	return nil
+}
+
+func (stubConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type stubStmt struct{}
+
+func (stubStmt) Close() error {
+	return nil
+}
+
+func (stubStmt) NumInput() int {
+	return -1
+}
+
+func (stubStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if stubQueryErr != nil {
+		return nil, stubQueryErr
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (stubStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if stubQueryErr != nil {
+		return nil, stubQueryErr
+	}
+	return emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string {
+	return nil
+}
+
+func (emptyRows) Close() error {
+	return nil
+}
+
+func (emptyRows) Next(dest []driver.Value) error {
+	return io.EOF
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serviceFilter restricts routes, stops and departures to the services a
+// user cares about. Zero values mean "no restriction".
+type serviceFilter struct {
+	Agency     sql.NullString // agency_id or agency_name, case-insensitive
+	RouteType  sql.NullInt64  // GTFS route_type, e.g. 0 tram, 2 rail, 3 bus
+	Accessible bool           // only wheelchair accessible stops and trips
+}
+
+// parseServiceFilter reads the agency and route_type query parameters.
+func parseServiceFilter(c *gin.Context) (serviceFilter, error) {
+	var filter serviceFilter
+
+	if agency := c.Query("agency"); agency != "" {
+		filter.Agency = sql.NullString{String: agency, Valid: true}
+	}
+
+	if accessible := c.Query("accessible"); accessible != "" {
+		v, err := strconv.ParseBool(accessible)
+		if err != nil {
+			return serviceFilter{}, invalidParam("accessible", "accessible must be true or false")
+		}
+		filter.Accessible = v
+	}
+
+	if routeType := c.Query("route_type"); routeType != "" {
+		v, err := strconv.ParseInt(routeType, 10, 64)
+		if err != nil {
+			return serviceFilter{}, invalidParam("route_type", "route_type must be an integer")
+		}
+		filter.RouteType = sql.NullInt64{Int64: v, Valid: true}
+	}
+
+	return filter, nil
+}
+
+// routeConditions returns SQL conditions applying the filter to the routes
+// table aliased as routes, with the agency table aliased as agency joined
+// to it. agencyArg and routeTypeArg are the placeholder numbers the caller
+// binds filter.Agency and filter.RouteType to.
+func routeConditions(routes, agency string, agencyArg, routeTypeArg int) string {
+	return fmt.Sprintf(`
+		AND ($%[3]d::TEXT IS NULL OR %[1]s.agency_id = $%[3]d OR lower(%[2]s.agency_name) = lower($%[3]d))
+		AND ($%[4]d::INTEGER IS NULL OR %[1]s.route_type = $%[4]d)`,
+		routes, agency, agencyArg, routeTypeArg)
+}
+
+// stopConditions returns an SQL condition keeping only stops, aliased as
+// stops, served by at least one route matching the filter. A parent station
+// matches when any of its platforms does.
+func stopConditions(stops string, agencyArg, routeTypeArg int) string {
+	return fmt.Sprintf(`
+		AND ($%[2]d::TEXT IS NULL AND $%[3]d::INTEGER IS NULL OR EXISTS (
+			SELECT 1 FROM stop_routes sr
+			JOIN routes fr ON sr.route_id = fr.route_id
+			LEFT JOIN agency fa ON fr.agency_id = fa.agency_id
+			WHERE (sr.stop_id = %[1]s.stop_id
+				OR sr.stop_id IN (SELECT cs.stop_id FROM stops cs WHERE cs.parent_station = %[1]s.stop_id))%[4]s
+		))`,
+		stops, agencyArg, routeTypeArg, routeConditions("fr", "fa", agencyArg, routeTypeArg))
+}
+
+// accessibleStopCondition returns an SQL condition that, when the boolean
+// placeholder accessibleArg is true, keeps only stops (aliased as stops)
+// with wheelchair boarding. As in GTFS, a platform with no information
+// inherits its parent station's value.
+func accessibleStopCondition(stops string, accessibleArg int) string {
+	return fmt.Sprintf(`
+		AND (NOT $%[2]d::BOOLEAN OR %[1]s.wheelchair_boarding = 1
+			OR coalesce(%[1]s.wheelchair_boarding, 0) = 0 AND EXISTS (
+				SELECT 1 FROM stops ap
+				WHERE ap.stop_id = %[1]s.parent_station
+				AND ap.wheelchair_boarding = 1
+			))`,
+		stops, accessibleArg)
+}
+
+const (
+	defaultDepartureLimit = 8
+	maxDepartureLimit     = 50
+)
+
+// departureOptions narrows the departures listed for each stop.
+type departureOptions struct {
+	Routes        []string      // route short names or route ids, lower case
+	Limit         int           // maximum departures per stop
+	WithinMinutes sql.NullInt64 // only departures leaving within this many minutes
+}
+
+// parseDepartureOptions reads the routes, limit and within_minutes query
+// parameters.
+func parseDepartureOptions(c *gin.Context) (departureOptions, error) {
+	options := departureOptions{Routes: []string{}, Limit: defaultDepartureLimit}
+
+	for _, route := range strings.Split(c.Query("routes"), ",") {
+		if route = strings.TrimSpace(route); route != "" {
+			options.Routes = append(options.Routes, strings.ToLower(route))
+		}
+	}
+
+	limit, err := queryInt(c, "limit", defaultDepartureLimit)
+	if err != nil || limit < 1 {
+		return departureOptions{}, invalidParam("limit", "limit must be a positive integer")
+	}
+	if limit > maxDepartureLimit {
+		limit = maxDepartureLimit
+	}
+	options.Limit = limit
+
+	if within := c.Query("within_minutes"); within != "" {
+		v, err := strconv.ParseInt(within, 10, 64)
+		if err != nil || v < 1 {
+			return departureOptions{}, invalidParam("within_minutes", "within_minutes must be a positive integer")
+		}
+		options.WithinMinutes = sql.NullInt64{Int64: v, Valid: true}
+	}
+
+	return options, nil
+}
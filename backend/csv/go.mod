@@ -2,9 +2,32 @@ module github.com/evanhearne/better_tfi/backend/csv
 
 go 1.23.2
 
-require github.com/gin-gonic/gin v1.10.0
+require (
+	github.com/evanhearne/better_tfi/backend/access v0.0.0
+	github.com/evanhearne/better_tfi/backend/compression v0.0.0
+	github.com/evanhearne/better_tfi/backend/config v0.0.0
+	github.com/evanhearne/better_tfi/backend/cors v0.0.0
+	github.com/evanhearne/better_tfi/backend/gtfsrjson v0.0.0
+	github.com/evanhearne/better_tfi/backend/httpcache v0.0.0
+	github.com/evanhearne/better_tfi/backend/logging v0.0.0
+	github.com/evanhearne/better_tfi/backend/metrics v0.0.0
+	github.com/evanhearne/better_tfi/backend/server v0.0.0
+	github.com/gin-gonic/gin v1.10.0
+	github.com/prometheus/client_golang v1.20.5
+)
 
 require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.55.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
 	github.com/bytedance/sonic v1.11.6 // indirect
 	github.com/bytedance/sonic/loader v0.1.1 // indirect
 	github.com/cloudwego/base64x v0.1.4 // indirect
@@ -26,10 +49,28 @@ require (
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.12 // indirect
 	golang.org/x/arch v0.8.0 // indirect
-	golang.org/x/crypto v0.23.0 // indirect
-	golang.org/x/net v0.25.0 // indirect
-	golang.org/x/sys v0.20.0 // indirect
-	golang.org/x/text v0.15.0 // indirect
-	google.golang.org/protobuf v1.34.1 // indirect
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/evanhearne/better_tfi/backend/access => ../access
+
+replace github.com/evanhearne/better_tfi/backend/compression => ../compression
+
+replace github.com/evanhearne/better_tfi/backend/config => ../config
+
+replace github.com/evanhearne/better_tfi/backend/cors => ../cors
+
+replace github.com/evanhearne/better_tfi/backend/gtfsrjson => ../gtfsrjson
+
+replace github.com/evanhearne/better_tfi/backend/httpcache => ../httpcache
+
+replace github.com/evanhearne/better_tfi/backend/metrics => ../metrics
+
+replace github.com/evanhearne/better_tfi/backend/logging => ../logging
+
+replace github.com/evanhearne/better_tfi/backend/server => ../server
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds the database checks behind /readyz so a hung
+// connection fails the probe instead of stalling it.
+const readinessTimeout = 2 * time.Second
+
+// getHealthz handles /healthz. It only reports that the process is serving
+// requests and never touches the database.
+func getHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// getReadyz handles /readyz. The service is ready when the database answers
+// and a static feed has been loaded into it. A failing check is logged and
+// reported in details as "unavailable", without the error itself.
+func getReadyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		notReady(c, gin.H{"database": "unavailable"}, fmt.Errorf("error pinging the database: %w", err))
+		return
+	}
+
+	feed, err := getFeedInfo(ctx)
+	if err != nil {
+		notReady(c, gin.H{"database": "ok", "feed": "unavailable"}, err)
+		return
+	}
+
+	stats := db.Stats()
+	c.JSON(http.StatusOK, gin.H{
+		"status":           "ok",
+		"database":         "ok",
+		"feed_version":     feed["feed_version"],
+		"feed_start_date":  feed["feed_start_date"],
+		"feed_end_date":    feed["feed_end_date"],
+		"feed_loaded_at":   feed["loaded_at"],
+		"open_connections": stats.OpenConnections,
+	})
+}
+
+func notReady(c *gin.Context, checks gin.H, err error) {
+	slog.ErrorContext(c.Request.Context(), "readiness check failed", "error", err)
+	respondError(c, http.StatusServiceUnavailable, codeUnavailable, "service unavailable", checks)
+}
+
+// getFeedInfo returns the most recently loaded static feed.
+func getFeedInfo(ctx context.Context) (map[string]interface{}, error) {
+	var feedVersion sql.NullString
+	var feedStartDate, feedEndDate, loadedAt sql.NullTime
+
+	err := db.QueryRowContext(ctx, `
+		SELECT feed_version, feed_start_date, feed_end_date, loaded_at
+		FROM feed_info
+		ORDER BY loaded_at DESC
+		LIMIT 1
+	`).Scan(&feedVersion, &feedStartDate, &feedEndDate, &loadedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no static feed loaded")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying feed info: %w", err)
+	}
+
+	return gin.H{
+		"feed_version":    feedVersion.String,
+		"feed_start_date": formatDate(feedStartDate),
+		"feed_end_date":   formatDate(feedEndDate),
+		"loaded_at":       loadedAt.Time.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func formatDate(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format("2006-01-02")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/evanhearne/better_tfi/backend/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	registry = metrics.NewRegistry()
+	factory  = promauto.With(registry)
+
+	requestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+	rateLimited = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_rate_limited_total",
+		Help: "Requests rejected with 429, by whether the client was identified by API key or IP.",
+	}, []string{"client"})
+	gtfsrResponses = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "csv_gtfsr_responses_total",
+		Help: "Requests to the gtfsr service by status code, or \"error\" if no response was received.",
+	}, []string{"code"})
+)
+
+// registerDBMetrics exposes the connection pool statistics of db and the
+// age of the loaded static feed.
+func registerDBMetrics() {
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "csv_db_open_connections",
+		Help: "Established database connections, in use or idle.",
+	}, func() float64 { return float64(db.Stats().OpenConnections) })
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "csv_db_in_use_connections",
+		Help: "Database connections currently in use.",
+	}, func() float64 { return float64(db.Stats().InUse) })
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "csv_db_idle_connections",
+		Help: "Idle database connections.",
+	}, func() float64 { return float64(db.Stats().Idle) })
+	factory.NewCounterFunc(prometheus.CounterOpts{
+		Name: "csv_db_wait_count_total",
+		Help: "Times a query waited for a free database connection.",
+	}, func() float64 { return float64(db.Stats().WaitCount) })
+	factory.NewCounterFunc(prometheus.CounterOpts{
+		Name: "csv_db_wait_duration_seconds_total",
+		Help: "Time spent waiting for a free database connection.",
+	}, func() float64 { return db.Stats().WaitDuration.Seconds() })
+
+	registry.MustRegister(metrics.NewOptionalGaugeFunc(prometheus.GaugeOpts{
+		Name: "csv_feed_age_seconds",
+		Help: "Seconds since the static feed was loaded into the database.",
+	}, func() (float64, bool) {
+		loadedAt, ok := feedLoadedAt()
+		return time.Since(loadedAt).Seconds(), ok
+	}))
+}
+
+// feedLoadedAt reads when the static feed was loaded, for the feed age
+// gauge. It reports false if the database cannot tell.
+func feedLoadedAt() (time.Time, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+	defer cancel()
+
+	var loadedAt time.Time
+	if err := db.QueryRowContext(ctx, `SELECT max(loaded_at) FROM feed_info`).Scan(&loadedAt); err != nil {
+		return time.Time{}, false
+	}
+	return loadedAt, true
+}
+
+// instrument records the latency and status code of every request, labelled
+// with the matched route pattern so ids in the path do not each become a
+// series.
+func instrument(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	requestDuration.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).Observe(time.Since(start).Seconds())
+}
+
+// recordGtfsrResponse counts a response, or a failed request when resp is
+// nil, from the gtfsr service.
+func recordGtfsrResponse(resp *http.Response) {
+	if resp == nil {
+		gtfsrResponses.WithLabelValues("error").Inc()
+		return
+	}
+	gtfsrResponses.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+}
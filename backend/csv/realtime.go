@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/evanhearne/better_tfi/backend/access"
+	"github.com/evanhearne/better_tfi/backend/gtfsrjson"
+	"github.com/evanhearne/better_tfi/backend/logging"
+)
+
+var gtfsrClient = &http.Client{}
+
+// The types below cover the subset of the GTFS-Realtime JSON feed served by
+// the gtfsr service that the csv service needs.
+
+type gtfsrFeed struct {
+	Entity []gtfsrEntity `json:"entity"`
+}
+
+type gtfsrEntity struct {
+	ID         string           `json:"id"`
+	TripUpdate *gtfsrTripUpdate `json:"trip_update"`
+}
+
+type gtfsrTripUpdate struct {
+	Trip           gtfsrTripDescriptor   `json:"trip"`
+	StopTimeUpdate []gtfsrStopTimeUpdate `json:"stop_time_update"`
+}
+
+type gtfsrTripDescriptor struct {
+	TripID               string `json:"trip_id"`
+	RouteID              string `json:"route_id"`
+	StartDate            string `json:"start_date"`
+	ScheduleRelationship string `json:"schedule_relationship"`
+}
+
+type gtfsrStopTimeUpdate struct {
+	StopSequence         *gtfsrjson.Int  `json:"stop_sequence"`
+	StopID               string          `json:"stop_id"`
+	Arrival              *gtfsrStopEvent `json:"arrival"`
+	Departure            *gtfsrStopEvent `json:"departure"`
+	ScheduleRelationship string          `json:"schedule_relationship"`
+}
+
+type gtfsrStopEvent struct {
+	Delay *gtfsrjson.Int `json:"delay"`
+	Time  *gtfsrjson.Int `json:"time"`
+}
+
+// fetchGtfsrFeed retrieves the current feed from the gtfsr service. It
+// returns a nil feed without error when no gtfsr service is configured.
+func fetchGtfsrFeed(ctx context.Context) (*gtfsrFeed, error) {
+	if cfg.GtfsrURL == "" {
+		return nil, nil
+	}
+
+	resp, err := gtfsrGet(ctx, "/gtfsr")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching gtfsr feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("received non-200 response from gtfsr service: %d", resp.StatusCode)
+	}
+
+	var feed gtfsrFeed
+	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("error decoding gtfsr feed: %w", err)
+	}
+	return &feed, nil
+}
+
+// gtfsrGet requests path from the gtfsr service, forwarding the request ID
+// so the logs of both services can be joined. It sends gtfsr_api_key so the
+// service's own calls are not refused when gtfsr requires an API key.
+func gtfsrGet(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.GtfsrURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+	if cfg.GtfsrAPIKey != "" {
+		req.Header.Set(access.APIKeyHeader, cfg.GtfsrAPIKey)
+	}
+
+	resp, err := gtfsrClient.Do(req)
+	recordGtfsrResponse(resp)
+	return resp, err
+}
+
+// findTripUpdate returns the trip update for tripID, or nil if the feed
+// has none.
+func (f *gtfsrFeed) findTripUpdate(tripID string) *gtfsrTripUpdate {
+	if f == nil {
+		return nil
+	}
+	for _, entity := range f.Entity {
+		if entity.TripUpdate != nil && entity.TripUpdate.Trip.TripID == tripID {
+			return entity.TripUpdate
+		}
+	}
+	return nil
+}
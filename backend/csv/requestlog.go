@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/evanhearne/better_tfi/backend/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// requestContext gives every request an ID, taken from the X-Request-ID
+// header when a proxy or another service set one. The ID is carried in the
+// request context, so log lines from handlers and database helpers include
+// it, and is echoed in the response.
+func requestContext(c *gin.Context) {
+	id := logging.EnsureRequestID(c.GetHeader(logging.RequestIDHeader))
+	c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+	c.Header(logging.RequestIDHeader, id)
+	c.Next()
+}
+
+// accessLog logs every request once it has been served.
+func accessLog(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	slog.InfoContext(c.Request.Context(), "request served",
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"route", c.FullPath(),
+		"status", c.Writer.Status(),
+		"duration_ms", time.Since(start).Milliseconds(),
+		"client_ip", c.ClientIP(),
+	)
+}
+
+// recoverPanic turns a panicking handler into a logged 500.
+var recoverPanic = gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+	slog.ErrorContext(c.Request.Context(), "panic serving request", "stack", string(debug.Stack()))
+	internalError(c, codeInternalError, fmt.Errorf("panic: %v", recovered))
+})
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+func getRoute(ctx context.Context, routeID string) (map[string]interface{}, error) {
+	var route_id, agency_id, agency_name, route_short_name, route_long_name, route_color, route_text_color sql.NullString
+	var route_type sql.NullInt64
+
+	err := db.QueryRowContext(ctx, `
+		SELECT r.route_id, r.agency_id, a.agency_name, r.route_short_name, r.route_long_name, r.route_type, r.route_color, r.route_text_color
+		FROM routes r
+		LEFT JOIN agency a ON r.agency_id = a.agency_id
+		WHERE r.route_id = $1
+	`, routeID).Scan(&route_id, &agency_id, &agency_name, &route_short_name, &route_long_name, &route_type, &route_color, &route_text_color)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching route: %w", err)
+	}
+
+	return gin.H{
+		"route_id":         route_id,
+		"agency_id":        agency_id,
+		"agency_name":      agency_name,
+		"route_short_name": route_short_name,
+		"route_long_name":  route_long_name,
+		"route_type":       route_type,
+		"route_color":      route_color,
+		"route_text_color": route_text_color,
+	}, nil
+}
+
+// getRouteStops handles /routes/:route_id/stops?direction= and returns, per
+// direction, the canonical stop pattern (the sequence run by most trips)
+// followed by the less common branch variants.
+func getRouteStops(c *gin.Context) {
+	ctx := c.Request.Context()
+	routeID := c.Param("route_id")
+
+	directionID, err := queryDirection(c)
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	route, err := getRoute(ctx, routeID)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	if route == nil {
+		notFound(c, "route not found")
+		return
+	}
+
+	patterns, err := getRouteStopPatterns(ctx, routeID, directionID)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	var stopIDs []string
+	for _, pattern := range patterns {
+		stopIDs = append(stopIDs, pattern.stopIDs...)
+	}
+
+	stops, err := getStopsByID(ctx, stopIDs)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	// Patterns arrive ordered by direction and then by trip count, so the
+	// first pattern seen for a direction is its canonical one.
+	directions := []map[string]interface{}{}
+	byDirection := map[int64]map[string]interface{}{}
+	for _, pattern := range patterns {
+		patternStops := make([]map[string]interface{}, 0, len(pattern.stopIDs))
+		for i, stopID := range pattern.stopIDs {
+			stop := gin.H{"stop_sequence": i + 1, "stop_id": stopID}
+			for key, value := range stops[stopID] {
+				stop[key] = value
+			}
+			patternStops = append(patternStops, stop)
+		}
+
+		direction, ok := byDirection[pattern.directionID]
+		if !ok {
+			direction = gin.H{
+				"direction_id": pattern.directionID,
+				"headsign":     pattern.headsign,
+				"trip_count":   pattern.tripCount,
+				"stops":        patternStops,
+				"variants":     []map[string]interface{}{},
+			}
+			byDirection[pattern.directionID] = direction
+			directions = append(directions, direction)
+			continue
+		}
+
+		direction["variants"] = append(direction["variants"].([]map[string]interface{}), gin.H{
+			"headsign":   pattern.headsign,
+			"trip_count": pattern.tripCount,
+			"stops":      patternStops,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"route_id":         routeID,
+		"route_short_name": route["route_short_name"].(sql.NullString).String,
+		"agency_name":      route["agency_name"].(sql.NullString).String,
+		"directions":       directions,
+	})
+}
+
+// queryDirection reads the optional direction query parameter, returning
+// nil when it is absent.
+func queryDirection(c *gin.Context) (*int, error) {
+	direction := c.Query("direction")
+	if direction == "" {
+		return nil, nil
+	}
+	d, err := strconv.Atoi(direction)
+	if err != nil || (d != 0 && d != 1) {
+		return nil, invalidParam("direction", "direction must be 0 or 1")
+	}
+	return &d, nil
+}
+
+type stopPattern struct {
+	directionID int64
+	headsign    string
+	tripCount   int
+	stopIDs     []string
+}
+
+// getRouteStopPatterns groups the trips of a route by their exact stop
+// sequence, most common pattern first within each direction.
+func getRouteStopPatterns(ctx context.Context, routeID string, directionID *int) ([]stopPattern, error) {
+	rows, err := db.QueryContext(ctx, `
+		WITH trip_patterns AS (
+			SELECT t.trip_id, t.direction_id, t.trip_headsign,
+				array_agg(s.stop_id ORDER BY s.stop_sequence) AS stop_ids
+			FROM trips t
+			JOIN stop_times s ON s.trip_id = t.trip_id
+			WHERE t.route_id = $1
+			AND ($2::INTEGER IS NULL OR t.direction_id = $2)
+			GROUP BY t.trip_id, t.direction_id, t.trip_headsign
+		)
+		SELECT coalesce(direction_id, 0), stop_ids, COUNT(*) AS trip_count,
+			coalesce(mode() WITHIN GROUP (ORDER BY trip_headsign), '')
+		FROM trip_patterns
+		GROUP BY direction_id, stop_ids
+		ORDER BY direction_id, trip_count DESC, array_length(stop_ids, 1) DESC
+	`, routeID, directionID)
+
+	if err != nil {
+		return nil, fmt.Errorf("error querying route stop patterns: %w", err)
+	}
+	defer rows.Close()
+
+	var patterns []stopPattern
+	for rows.Next() {
+		var pattern stopPattern
+		var stopIDs pq.StringArray
+		if err := rows.Scan(&pattern.directionID, &stopIDs, &pattern.tripCount, &pattern.headsign); err != nil {
+			return nil, fmt.Errorf("error scanning stop pattern row: %w", err)
+		}
+		pattern.stopIDs = stopIDs
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// getStopsByID looks up the code, name and coordinates of each stop in one
+// query, keyed by stop_id.
+func getStopsByID(ctx context.Context, stopIDs []string) (map[string]map[string]interface{}, error) {
+	stops := map[string]map[string]interface{}{}
+	if len(stopIDs) == 0 {
+		return stops, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT stop_id, stop_code, stop_name, stop_lat, stop_lon
+		FROM stops
+		WHERE stop_id = ANY($1)
+	`, pq.Array(stopIDs))
+
+	if err != nil {
+		return nil, fmt.Errorf("error querying stops: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var stopID, stopCode, stopName sql.NullString
+		var lat, lon sql.NullFloat64
+		if err := rows.Scan(&stopID, &stopCode, &stopName, &lat, &lon); err != nil {
+			return nil, fmt.Errorf("error scanning stop row: %w", err)
+		}
+
+		stops[stopID.String] = gin.H{
+			"stop_code": stopCode.String,
+			"stop_name": stopName.String,
+			"stop_lat":  lat.Float64,
+			"stop_lon":  lon.Float64,
+		}
+	}
+	return stops, nil
+}
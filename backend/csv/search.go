@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+)
+
+// search handles /search?q=&limit=&offset= and returns stops, parent
+// stations and routes in a single ranked list so the app's search bar can
+// show mixed results.
+func search(c *gin.Context) {
+	ctx := c.Request.Context()
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		badRequest(c, invalidParam("q", "q is required"))
+		return
+	}
+
+	limit, err := queryInt(c, "limit", defaultSearchLimit)
+	if err != nil || limit < 1 {
+		badRequest(c, invalidParam("limit", "limit must be a positive integer"))
+		return
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		badRequest(c, invalidParam("offset", "offset must be a non-negative integer"))
+		return
+	}
+
+	// Fetch one extra row to know whether another page exists.
+	results, err := searchAll(ctx, query, limit+1, offset)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	hasMore := len(results) > limit
+	if hasMore {
+		results = results[:limit]
+	}
+
+	response := gin.H{
+		"query":    query,
+		"limit":    limit,
+		"offset":   offset,
+		"has_more": hasMore,
+		"results":  results,
+	}
+	if hasMore {
+		response["next_offset"] = offset + limit
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func searchAll(ctx context.Context, query string, limit, offset int) ([]map[string]interface{}, error) {
+	// Child platforms are left out; they are reachable through their parent
+	// station. Exact stop codes and route short names score 1.0 so they
+	// always rank above fuzzy name matches.
+	rows, err := db.QueryContext(ctx, `
+		WITH q AS (SELECT normalize_search_text($1) AS term, $1::TEXT AS raw)
+		SELECT type, id, code, name, long_name, score FROM (
+			SELECT
+				CASE WHEN location_type = 1 THEN 'station' ELSE 'stop' END AS type,
+				stop_id AS id,
+				stop_code AS code,
+				stop_name AS name,
+				NULL::TEXT AS long_name,
+				CASE WHEN stop_code = q.raw THEN 1.0::FLOAT8
+					ELSE GREATEST(similarity(search_name, q.term), word_similarity(q.term, search_name))::FLOAT8
+				END AS score
+			FROM stops, q
+			WHERE q.term <> ''
+			AND coalesce(parent_station, '') = ''
+			AND (q.term <% search_name
+				OR search_name LIKE '%' || q.term || '%'
+				OR starts_with(stop_code, q.raw))
+			UNION ALL
+			SELECT
+				'route' AS type,
+				route_id AS id,
+				route_short_name AS code,
+				route_short_name AS name,
+				route_long_name AS long_name,
+				CASE WHEN lower(route_short_name) = lower(q.raw) THEN 1.0::FLOAT8
+					WHEN starts_with(lower(route_short_name), lower(q.raw)) THEN 0.9::FLOAT8
+					ELSE word_similarity(q.term, normalize_search_text(route_long_name))::FLOAT8
+				END AS score
+			FROM routes, q
+			WHERE q.term <> ''
+			AND (starts_with(lower(route_short_name), lower(q.raw))
+				OR q.term <% normalize_search_text(route_long_name)
+				OR normalize_search_text(route_long_name) LIKE '%' || q.term || '%')
+		) results
+		ORDER BY score DESC, type, name
+		LIMIT $2 OFFSET $3
+	`, query, limit, offset)
+
+	if err != nil {
+		return nil, fmt.Errorf("error querying search results: %w", err)
+	}
+	defer rows.Close()
+
+	results := []map[string]interface{}{}
+	for rows.Next() {
+		var resultType, id, code, name, longName sql.NullString
+		var score sql.NullFloat64
+		if err := rows.Scan(&resultType, &id, &code, &name, &longName, &score); err != nil {
+			return nil, fmt.Errorf("error scanning search row: %w", err)
+		}
+
+		result := gin.H{
+			"type":  resultType.String,
+			"id":    id.String,
+			"name":  name.String,
+			"score": score.Float64,
+		}
+		switch resultType.String {
+		case "route":
+			result["route_short_name"] = code.String
+			result["route_long_name"] = longName.String
+		default:
+			result["stop_code"] = code.String
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// queryInt reads an optional integer query parameter, returning fallback
+// when it is absent.
+func queryInt(c *gin.Context, key string, fallback int) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
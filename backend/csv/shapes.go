@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultShapeTolerance = 5.0 // metres
+	earthRadius           = 6371000.0
+)
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONLineString      `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONLineString struct {
+	Type        string       `json:"type"`
+	Coordinates [][2]float64 `json:"coordinates"` // [lon, lat] as GeoJSON requires
+}
+
+// getRouteShape handles /routes/:route_id/shape?direction=&tolerance= and
+// returns a GeoJSON FeatureCollection with one LineString per distinct
+// shape used by the route's trips. tolerance is the Douglas-Peucker
+// simplification tolerance in metres; 0 returns the shape unsimplified.
+func getRouteShape(c *gin.Context) {
+	ctx := c.Request.Context()
+	routeID := c.Param("route_id")
+
+	directionID, err := queryDirection(c)
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	tolerance := defaultShapeTolerance
+	if value := c.Query("tolerance"); value != "" {
+		t, err := strconv.ParseFloat(value, 64)
+		if err != nil || t < 0 || math.IsNaN(t) || math.IsInf(t, 0) {
+			badRequest(c, invalidParam("tolerance", "tolerance must be a non-negative number of metres"))
+			return
+		}
+		tolerance = t
+	}
+
+	route, err := getRoute(ctx, routeID)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	if route == nil {
+		notFound(c, "route not found")
+		return
+	}
+
+	shapes, err := getRouteShapeIDs(ctx, routeID, directionID)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	shapeIDs := make([]string, 0, len(shapes))
+	for _, shape := range shapes {
+		shapeIDs = append(shapeIDs, shape["shape_id"].(string))
+	}
+
+	points, err := getShapePoints(ctx, shapeIDs)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	collection := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+	for _, shape := range shapes {
+		coordinates := points[shape["shape_id"].(string)]
+		if len(coordinates) < 2 {
+			continue
+		}
+
+		shape["route_id"] = routeID
+		shape["route_short_name"] = route["route_short_name"].(sql.NullString).String
+		collection.Features = append(collection.Features, geoJSONFeature{
+			Type: "Feature",
+			Geometry: geoJSONLineString{
+				Type:        "LineString",
+				Coordinates: simplifyLine(coordinates, tolerance),
+			},
+			Properties: shape,
+		})
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+// getRouteShapeIDs returns the distinct shapes of a route, most used first
+// within each direction.
+func getRouteShapeIDs(ctx context.Context, routeID string, directionID *int) ([]map[string]interface{}, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT shape_id, direction_id, COUNT(*) AS trip_count
+		FROM trips
+		WHERE route_id = $1
+		AND ($2::INTEGER IS NULL OR direction_id = $2)
+		AND coalesce(shape_id, '') <> ''
+		GROUP BY shape_id, direction_id
+		ORDER BY direction_id, trip_count DESC, shape_id
+	`, routeID, directionID)
+
+	if err != nil {
+		return nil, fmt.Errorf("error querying route shapes: %w", err)
+	}
+	defer rows.Close()
+
+	var shapes []map[string]interface{}
+	for rows.Next() {
+		var shapeID sql.NullString
+		var direction sql.NullInt64
+		var tripCount int
+		if err := rows.Scan(&shapeID, &direction, &tripCount); err != nil {
+			return nil, fmt.Errorf("error scanning shape row: %w", err)
+		}
+
+		shapes = append(shapes, gin.H{
+			"shape_id":     shapeID.String,
+			"direction_id": direction.Int64,
+			"trip_count":   tripCount,
+		})
+	}
+	return shapes, nil
+}
+
+// getShapePoints loads the points of each shape in sequence order as
+// [lon, lat] pairs.
+func getShapePoints(ctx context.Context, shapeIDs []string) (map[string][][2]float64, error) {
+	points := map[string][][2]float64{}
+	if len(shapeIDs) == 0 {
+		return points, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT shape_id, shape_pt_lat, shape_pt_lon
+		FROM shapes
+		WHERE shape_id = ANY($1)
+		ORDER BY shape_id, shape_pt_sequence
+	`, pq.Array(shapeIDs))
+
+	if err != nil {
+		return nil, fmt.Errorf("error querying shape points: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var shapeID string
+		var lat, lon float64
+		if err := rows.Scan(&shapeID, &lat, &lon); err != nil {
+			return nil, fmt.Errorf("error scanning shape point row: %w", err)
+		}
+		points[shapeID] = append(points[shapeID], [2]float64{lon, lat})
+	}
+	return points, nil
+}
+
+// simplifyLine applies Douglas-Peucker simplification to a [lon, lat]
+// polyline, dropping points closer than tolerance metres to the
+// simplified line.
+func simplifyLine(points [][2]float64, tolerance float64) [][2]float64 {
+	if tolerance <= 0 || len(points) < 3 {
+		return points
+	}
+
+	// Project onto a local equirectangular plane in metres; accurate
+	// enough at the scale of a single route.
+	cosLat := math.Cos(points[0][1] * math.Pi / 180)
+	projected := make([][2]float64, len(points))
+	for i, p := range points {
+		projected[i] = [2]float64{
+			p[0] * math.Pi / 180 * earthRadius * cosLat,
+			p[1] * math.Pi / 180 * earthRadius,
+		}
+	}
+
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+
+	stack := [][2]int{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		maxDistance, index := 0.0, -1
+		for i := span[0] + 1; i < span[1]; i++ {
+			d := perpendicularDistance(projected[i], projected[span[0]], projected[span[1]])
+			if d > maxDistance {
+				maxDistance, index = d, i
+			}
+		}
+
+		if index != -1 && maxDistance > tolerance {
+			keep[index] = true
+			stack = append(stack, [2]int{span[0], index}, [2]int{index, span[1]})
+		}
+	}
+
+	simplified := make([][2]float64, 0, len(points))
+	for i, p := range points {
+		if keep[i] {
+			simplified = append(simplified, p)
+		}
+	}
+	return simplified
+}
+
+func perpendicularDistance(p, start, end [2]float64) float64 {
+	dx, dy := end[0]-start[0], end[1]-start[1]
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p[0]-start[0], p[1]-start[1])
+	}
+	t := ((p[0]-start[0])*dx + (p[1]-start[1])*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p[0]-(start[0]+t*dx), p[1]-(start[1]+t*dy))
+}
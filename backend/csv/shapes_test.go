@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSimplifyLine(t *testing.T) {
+	// The distance, about 11 metres, of the middle point of a shallow
+	// triangle on the equator from its base, projected the same way
+	// simplifyLine projects it.
+	project := func(p [2]float64) [2]float64 {
+		return [2]float64{p[0] * math.Pi / 180 * earthRadius * 1, p[1] * math.Pi / 180 * earthRadius}
+	}
+	offset := perpendicularDistance(project([2]float64{0.0001, 0.0001}), project([2]float64{0, 0}), project([2]float64{0.0002, 0}))
+
+	tests := []struct {
+		name      string
+		points    [][2]float64
+		tolerance float64
+		want      [][2]float64
+	}{
+		{
+			name:      "collinear points",
+			points:    [][2]float64{{0, 0}, {0.001, 0}, {0.002, 0}, {0.003, 0}},
+			tolerance: 1,
+			want:      [][2]float64{{0, 0}, {0.003, 0}},
+		},
+		{
+			name:      "single point",
+			points:    [][2]float64{{-6.26, 53.35}},
+			tolerance: 10,
+			want:      [][2]float64{{-6.26, 53.35}},
+		},
+		{
+			name:      "zero tolerance",
+			points:    [][2]float64{{0, 0}, {0.001, 0}, {0.002, 0}},
+			tolerance: 0,
+			want:      [][2]float64{{0, 0}, {0.001, 0}, {0.002, 0}},
+		},
+		{
+			name:      "point just beyond tolerance",
+			points:    [][2]float64{{0, 0}, {0.0001, 0.0001}, {0.0002, 0}},
+			tolerance: offset - 0.01,
+			want:      [][2]float64{{0, 0}, {0.0001, 0.0001}, {0.0002, 0}},
+		},
+		{
+			name:      "point at tolerance",
+			points:    [][2]float64{{0, 0}, {0.0001, 0.0001}, {0.0002, 0}},
+			tolerance: offset,
+			want:      [][2]float64{{0, 0}, {0.0002, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := simplifyLine(tt.points, tt.tolerance)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("simplifyLine() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPerpendicularDistance(t *testing.T) {
+	tests := []struct {
+		name       string
+		p          [2]float64
+		start, end [2]float64
+		want       float64
+	}{
+		{"on the segment", [2]float64{5, 0}, [2]float64{0, 0}, [2]float64{10, 0}, 0},
+		{"beside the segment", [2]float64{5, 3}, [2]float64{0, 0}, [2]float64{10, 0}, 3},
+		{"beyond the end", [2]float64{13, 4}, [2]float64{0, 0}, [2]float64{10, 0}, 5},
+		{"degenerate segment", [2]float64{3, 4}, [2]float64{0, 0}, [2]float64{0, 0}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := perpendicularDistance(tt.p, tt.start, tt.end); got != tt.want {
+				t.Errorf("perpendicularDistance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getStopDetail handles /stops/:stop_id and returns the stop's metadata,
+// its child platforms and the routes serving it today.
+func getStopDetail(c *gin.Context) {
+	ctx := c.Request.Context()
+	stopID := c.Param("stop_id")
+
+	stop, err := getStop(ctx, stopID)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	if stop == nil {
+		notFound(c, "stop not found")
+		return
+	}
+
+	children, err := getChildStops(ctx, stopID)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	currentDate, _, dayOfWeekColumn := getCurrentDateAndTimeInfo()
+
+	routes, err := getRoutesServingStop(ctx, stopID, currentDate, dayOfWeekColumn)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	plainValues(stop)
+	for _, child := range children {
+		plainValues(child)
+	}
+	stop["child_stops"] = children
+	stop["routes"] = routes
+
+	c.JSON(http.StatusOK, stop)
+}
+
+func getChildStops(ctx context.Context, parentStationID string) ([]map[string]interface{}, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT stop_id, stop_code, stop_name, stop_lat, stop_lon, wheelchair_boarding
+		FROM stops
+		WHERE parent_station = $1
+		ORDER BY stop_name, stop_code
+	`, parentStationID)
+
+	if err != nil {
+		return nil, fmt.Errorf("error querying child stops: %w", err)
+	}
+	defer rows.Close()
+
+	children := []map[string]interface{}{}
+	for rows.Next() {
+		var stopID, stopCode, stopName sql.NullString
+		var lat, lon sql.NullFloat64
+		var wheelchairBoarding sql.NullInt64
+		if err := rows.Scan(&stopID, &stopCode, &stopName, &lat, &lon, &wheelchairBoarding); err != nil {
+			return nil, fmt.Errorf("error scanning child stop row: %w", err)
+		}
+
+		children = append(children, gin.H{
+			"stop_id":             stopID,
+			"stop_code":           stopCode,
+			"stop_name":           stopName,
+			"stop_lat":            lat,
+			"stop_lon":            lon,
+			"wheelchair_boarding": wheelchairBoarding,
+		})
+	}
+	return children, nil
+}
+
+// getRoutesServingStop returns the distinct routes with a trip calling at
+// stopID, or at one of its platforms when it is a station, on currentDate,
+// each with the headsigns it runs under.
+func getRoutesServingStop(ctx context.Context, stopID, currentDate, dayColumn string) ([]map[string]interface{}, error) {
+	query := fmt.Sprintf(`
+		SELECT DISTINCT r.route_id, r.route_short_name, r.route_long_name, t.direction_id, t.trip_headsign
+		FROM stop_times s
+		JOIN trips t ON s.trip_id = t.trip_id
+		JOIN routes r ON t.route_id = r.route_id
+		JOIN calendar c ON t.service_id = c.service_id
+		WHERE s.stop_id IN (SELECT stop_id FROM stops WHERE stop_id = $1 OR parent_station = $1)
+		AND c.%s = 1
+		AND c.start_date <= $2
+		AND c.end_date >= $2
+		ORDER BY r.route_short_name, r.route_id, t.direction_id, t.trip_headsign`, dayColumn)
+
+	rows, err := db.QueryContext(ctx, query, stopID, currentDate)
+	if err != nil {
+		return nil, fmt.Errorf("error querying routes for stop: %w", err)
+	}
+	defer rows.Close()
+
+	routes := []map[string]interface{}{}
+	byRouteID := map[string]map[string]interface{}{}
+	for rows.Next() {
+		var routeID, routeShortName, routeLongName, headsign sql.NullString
+		var directionID sql.NullInt64
+		if err := rows.Scan(&routeID, &routeShortName, &routeLongName, &directionID, &headsign); err != nil {
+			return nil, fmt.Errorf("error scanning route row: %w", err)
+		}
+
+		route, ok := byRouteID[routeID.String]
+		if !ok {
+			route = gin.H{
+				"route_id":         routeID.String,
+				"route_short_name": routeShortName.String,
+				"route_long_name":  routeLongName.String,
+				"headsigns":        []string{},
+			}
+			byRouteID[routeID.String] = route
+			routes = append(routes, route)
+		}
+
+		if headsign.Valid && headsign.String != "" {
+			route["headsigns"] = append(route["headsigns"].([]string), headsign.String)
+		}
+	}
+	return routes, nil
+}
+
+// plainValues replaces the sql.Null* values in row with their value, or nil
+// when NULL, so they encode as plain JSON strings and numbers. Times are
+// service dates and are written as YYYY-MM-DD.
+func plainValues(row map[string]interface{}) {
+	for key, value := range row {
+		switch v := value.(type) {
+		case sql.NullString:
+			row[key] = nil
+			if v.Valid {
+				row[key] = v.String
+			}
+		case sql.NullInt64:
+			row[key] = nil
+			if v.Valid {
+				row[key] = v.Int64
+			}
+		case sql.NullFloat64:
+			row[key] = nil
+			if v.Valid {
+				row[key] = v.Float64
+			}
+		case sql.NullTime:
+			row[key] = nil
+			if v.Valid {
+				row[key] = v.Time.Format("2006-01-02")
+			}
+		}
+	}
+}
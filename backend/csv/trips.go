@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// getTripDetail handles /trips/:trip_id and returns the trip's route,
+// service dates and ordered stop list, with real-time predictions overlaid
+// when the gtfsr service has an update for the trip.
+func getTripDetail(c *gin.Context) {
+	ctx := c.Request.Context()
+	tripID := c.Param("trip_id")
+
+	trip, err := getTrip(ctx, tripID)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	if trip == nil {
+		notFound(c, "trip not found")
+		return
+	}
+
+	serviceID := trip["service_id"].(sql.NullString)
+	calendar, err := getCalendar(ctx, serviceID.String)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	days := []string{}
+	if calendar != nil {
+		for _, day := range []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"} {
+			if calendarDay, ok := calendar[day].(sql.NullString); ok && calendarDay.String == "1" {
+				days = append(days, day)
+			}
+		}
+		trip["start_date"] = calendar["start_date"]
+		trip["end_date"] = calendar["end_date"]
+	}
+	trip["days"] = days
+
+	stopTimes, err := getStopTimes(ctx, tripID)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	stops, err := getTripStops(ctx, stopTimes)
+	if err != nil {
+		internalError(c, codeDatabaseError, err)
+		return
+	}
+
+	// Real-time data is best effort; the schedule is still useful without it.
+	trip["realtime"] = false
+	feed, err := fetchGtfsrFeed(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "error fetching real-time data", "trip_id", tripID, "error", err)
+	} else if update := feed.findTripUpdate(tripID); update != nil {
+		overlayTripUpdate(stops, update)
+		trip["realtime"] = true
+		trip["schedule_relationship"] = update.Trip.ScheduleRelationship
+	}
+
+	plainValues(trip)
+	for _, stop := range stops {
+		plainValues(stop)
+	}
+	trip["stops"] = stops
+
+	c.JSON(http.StatusOK, trip)
+}
+
+func getTrip(ctx context.Context, tripID string) (map[string]interface{}, error) {
+	if tripID == "" {
+		return nil, fmt.Errorf("error: tripID is required to not be empty")
+	}
+
+	var trip_id, route_id, route_short_name, route_long_name, agency_name, service_id, trip_headsign, shape_id sql.NullString
+	var direction_id, wheelchair_accessible, bikes_allowed sql.NullInt64
+
+	err := db.QueryRowContext(ctx, `
+		SELECT t.trip_id, t.route_id, r.route_short_name, r.route_long_name, a.agency_name, t.service_id, t.trip_headsign, t.direction_id, t.shape_id,
+			t.wheelchair_accessible, t.bikes_allowed
+		FROM trips t
+		LEFT JOIN routes r ON t.route_id = r.route_id
+		LEFT JOIN agency a ON r.agency_id = a.agency_id
+		WHERE t.trip_id = $1
+	`, tripID).Scan(&trip_id, &route_id, &route_short_name, &route_long_name, &agency_name, &service_id, &trip_headsign, &direction_id, &shape_id,
+		&wheelchair_accessible, &bikes_allowed)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching trip: %w", err)
+	}
+
+	return gin.H{
+		"trip_id":               trip_id,
+		"route_id":              route_id,
+		"route_short_name":      route_short_name,
+		"route_long_name":       route_long_name,
+		"agency_name":           agency_name,
+		"service_id":            service_id,
+		"trip_headsign":         trip_headsign,
+		"direction_id":          direction_id,
+		"shape_id":              shape_id,
+		"wheelchair_accessible": wheelchair_accessible,
+		"bikes_allowed":         bikes_allowed,
+	}, nil
+}
+
+// getTripStops turns the rows from getStopTimes into the stop list of a
+// trip detail response, looking up all stop names in one query.
+func getTripStops(ctx context.Context, stopTimes []map[string]interface{}) ([]map[string]interface{}, error) {
+	stopIDs := make([]string, 0, len(stopTimes))
+	for _, stopTime := range stopTimes {
+		stopIDs = append(stopIDs, stopTime["stop_id"].(sql.NullString).String)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT stop_id, stop_name FROM stops WHERE stop_id = ANY($1)`, pq.Array(stopIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error querying stop names: %w", err)
+	}
+	defer rows.Close()
+
+	stopNames := map[string]sql.NullString{}
+	for rows.Next() {
+		var stopID, stopName sql.NullString
+		if err := rows.Scan(&stopID, &stopName); err != nil {
+			return nil, fmt.Errorf("error scanning stop row: %w", err)
+		}
+		stopNames[stopID.String] = stopName
+	}
+
+	stops := make([]map[string]interface{}, 0, len(stopTimes))
+	for _, stopTime := range stopTimes {
+		stopID := stopTime["stop_id"].(sql.NullString)
+		stops = append(stops, gin.H{
+			"stop_sequence":  stopTime["stop_sequence"],
+			"stop_id":        stopID,
+			"stop_name":      stopNames[stopID.String],
+			"arrival_time":   formatScheduledTime(stopTime["arrival_time"].(sql.NullTime)),
+			"departure_time": formatScheduledTime(stopTime["departure_time"].(sql.NullTime)),
+			"pickup_type":    stopTime["pickup_type"],
+			"drop_off_type":  stopTime["drop_off_type"],
+		})
+	}
+	return stops, nil
+}
+
+// overlayTripUpdate adds predicted times to stops. As in the GTFS-Realtime
+// spec, a delay applies to every following stop until the next update;
+// stops before the first update get no prediction.
+func overlayTripUpdate(stops []map[string]interface{}, update *gtfsrTripUpdate) {
+	var arrivalDelay, departureDelay *int64
+
+	for _, stop := range stops {
+		stopSequence := stop["stop_sequence"].(sql.NullInt64)
+		stopID := stop["stop_id"].(sql.NullString)
+
+		for _, stu := range update.StopTimeUpdate {
+			matches := stu.StopSequence != nil && int64(*stu.StopSequence) == stopSequence.Int64 ||
+				stu.StopSequence == nil && stu.StopID == stopID.String
+			if !matches {
+				continue
+			}
+
+			stop["schedule_relationship"] = stu.ScheduleRelationship
+			if stu.Arrival != nil && stu.Arrival.Delay != nil {
+				delay := int64(*stu.Arrival.Delay)
+				arrivalDelay = &delay
+			}
+			if stu.Departure != nil && stu.Departure.Delay != nil {
+				delay := int64(*stu.Departure.Delay)
+				departureDelay = &delay
+			} else if arrivalDelay != nil {
+				departureDelay = arrivalDelay
+			}
+			if arrivalDelay == nil {
+				arrivalDelay = departureDelay
+			}
+			if stu.Arrival != nil && stu.Arrival.Time != nil {
+				stop["predicted_arrival_time"] = formatUnixTime(int64(*stu.Arrival.Time))
+			}
+			if stu.Departure != nil && stu.Departure.Time != nil {
+				stop["predicted_departure_time"] = formatUnixTime(int64(*stu.Departure.Time))
+			}
+			break
+		}
+
+		if arrivalDelay != nil {
+			stop["arrival_delay"] = *arrivalDelay
+			if _, ok := stop["predicted_arrival_time"]; !ok {
+				stop["predicted_arrival_time"] = shiftClockTime(stop["arrival_time"].(string), *arrivalDelay)
+			}
+		}
+		if departureDelay != nil {
+			stop["departure_delay"] = *departureDelay
+			if _, ok := stop["predicted_departure_time"]; !ok {
+				stop["predicted_departure_time"] = shiftClockTime(stop["departure_time"].(string), *departureDelay)
+			}
+		}
+	}
+}
+
+func formatScheduledTime(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format("15:04:05")
+}
+
+func formatUnixTime(seconds int64) string {
+	loc, _ := time.LoadLocation("Europe/Dublin")
+	return time.Unix(seconds, 0).In(loc).Format("15:04:05")
+}
+
+// shiftClockTime adds delaySeconds to an HH:MM:SS clock time.
+func shiftClockTime(clock string, delaySeconds int64) string {
+	t, err := time.Parse("15:04:05", clock)
+	if err != nil {
+		return ""
+	}
+	return t.Add(time.Duration(delaySeconds) * time.Second).Format("15:04:05")
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/evanhearne/better_tfi/backend/gtfsrjson"
+)
+
+var (
+	alertsCache          *alertFeed
+	alertsCacheTimestamp time.Time
+	alertsCacheMutex     sync.Mutex
+
+	// Outcome of alerts fetches, read by the metrics without alertsCacheMutex
+	alertsStatus feedStatus
+)
+
+// The types below follow the GTFS-Realtime JSON encoding of service alerts.
+
+type alertFeed struct {
+	Header map[string]interface{} `json:"header,omitempty"`
+	Entity []alertEntity          `json:"entity"`
+}
+
+type alertEntity struct {
+	ID    string `json:"id"`
+	Alert *alert `json:"alert,omitempty"`
+}
+
+type alert struct {
+	ActivePeriod    []timeRange       `json:"active_period,omitempty"`
+	InformedEntity  []entitySelector  `json:"informed_entity"`
+	Cause           string            `json:"cause,omitempty"`
+	Effect          string            `json:"effect,omitempty"`
+	URL             *translatedString `json:"url,omitempty"`
+	HeaderText      *translatedString `json:"header_text,omitempty"`
+	DescriptionText *translatedString `json:"description_text,omitempty"`
+}
+
+type timeRange struct {
+	Start gtfsrjson.Int `json:"start,omitempty"`
+	End   gtfsrjson.Int `json:"end,omitempty"`
+}
+
+type entitySelector struct {
+	AgencyID  string          `json:"agency_id,omitempty"`
+	RouteID   string          `json:"route_id,omitempty"`
+	RouteType *int            `json:"route_type,omitempty"`
+	Trip      *tripDescriptor `json:"trip,omitempty"`
+	StopID    string          `json:"stop_id,omitempty"`
+}
+
+type tripDescriptor struct {
+	TripID  string `json:"trip_id,omitempty"`
+	RouteID string `json:"route_id,omitempty"`
+}
+
+type translatedString struct {
+	Translation []translation `json:"translation"`
+}
+
+type translation struct {
+	Text     string `json:"text"`
+	Language string `json:"language,omitempty"`
+}
+
+func handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	feed, fetchedAt, err := getCachedAlerts()
+	if err != nil {
+		upstreamError(w, r, err)
+		return
+	}
+
+	if checkCached(w, r, fetchedAt) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	routeID := r.URL.Query().Get("route_id")
+	stopID := r.URL.Query().Get("stop_id")
+
+	response, err := json.Marshal(feed.filter(time.Now(), routeID, stopID))
+	if err != nil {
+		internalError(w, r, fmt.Errorf("error encoding alerts: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func getCachedAlerts() (*alertFeed, time.Time, error) {
+	alertsCacheMutex.Lock()
+	defer alertsCacheMutex.Unlock()
+
+	// Same TTL as the trip updates cache
+	if time.Since(alertsCacheTimestamp) < cfg.CacheTTL && alertsCache != nil {
+		cacheRequests.WithLabelValues("alerts", "hit").Inc()
+		return alertsCache, alertsCacheTimestamp, nil
+	}
+	cacheRequests.WithLabelValues("alerts", "miss").Inc()
+
+	feed, err := fetchAlerts()
+	if err != nil {
+		alertsStatus.failed(err)
+		return nil, time.Time{}, err
+	}
+
+	alertsCache = feed
+	alertsCacheTimestamp = time.Now()
+	alertsStatus.succeeded(alertsCacheTimestamp)
+
+	return feed, alertsCacheTimestamp, nil
+}
+
+// fetchAlerts loads service alerts from the alerts_url setting if set,
+// otherwise from alerts_file. With neither configured there are no alerts.
+func fetchAlerts() (*alertFeed, error) {
+	var body []byte
+
+	switch {
+	case cfg.AlertsURL != "":
+		req, err := http.NewRequest("GET", cfg.AlertsURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+
+		req.Header.Set("Cache-Control", "no-cache")
+		req.Header.Set("x-api-key", cfg.APIKey)
+
+		resp, err := upstreamClient.Do(req)
+		recordUpstream("alerts", resp)
+		if err != nil {
+			return nil, fmt.Errorf("error making HTTP request: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("received non-200 response: %d", resp.StatusCode)
+		}
+
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error reading response body: %w", err)
+		}
+	case cfg.AlertsFile != "":
+		var err error
+		body, err = os.ReadFile(cfg.AlertsFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading alerts file: %w", err)
+		}
+	default:
+		return &alertFeed{Entity: []alertEntity{}}, nil
+	}
+
+	var feed alertFeed
+	if err := json.Unmarshal(body, &feed); err != nil {
+		return nil, fmt.Errorf("error decoding alerts: %w", err)
+	}
+	return &feed, nil
+}
+
+// filter returns the alerts active at now that affect routeID and stopID.
+// Empty ids match everything. An informed entity matches when its route and
+// its stop are each either unset or equal to the requested one, so an entity
+// naming only a route applies at every stop of it. An entity naming neither,
+// such as one naming only an agency or route type, is not matched by a route
+// or stop filter: this service has no schedule to tell which routes it
+// covers. The csv service matches custom alerts by the same rule.
+func (f *alertFeed) filter(now time.Time, routeID, stopID string) *alertFeed {
+	filtered := &alertFeed{Header: f.Header, Entity: []alertEntity{}}
+	for _, entity := range f.Entity {
+		if entity.Alert == nil || !entity.Alert.activeAt(now) {
+			continue
+		}
+		if entity.Alert.affects(routeID, stopID) {
+			filtered.Entity = append(filtered.Entity, entity)
+		}
+	}
+	return filtered
+}
+
+func (a *alert) activeAt(now time.Time) bool {
+	if len(a.ActivePeriod) == 0 {
+		return true
+	}
+	for _, period := range a.ActivePeriod {
+		if (period.Start == 0 || int64(period.Start) <= now.Unix()) && (period.End == 0 || now.Unix() < int64(period.End)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *alert) affects(routeID, stopID string) bool {
+	if routeID == "" && stopID == "" {
+		return true
+	}
+	for _, selector := range a.InformedEntity {
+		selectorRouteID := selector.RouteID
+		if selectorRouteID == "" && selector.Trip != nil {
+			selectorRouteID = selector.Trip.RouteID
+		}
+
+		// Agencies, route types and trips given without their route cannot
+		// be placed on a route or stop.
+		if selectorRouteID == "" && selector.StopID == "" {
+			continue
+		}
+		if (routeID == "" || selectorRouteID == "" || selectorRouteID == routeID) &&
+			(stopID == "" || selector.StopID == "" || selector.StopID == stopID) {
+			return true
+		}
+	}
+	return false
+}
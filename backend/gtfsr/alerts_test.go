@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestAlertAffects(t *testing.T) {
+	busType := 3
+
+	tests := []struct {
+		name     string
+		selector entitySelector
+		routeID  string
+		stopID   string
+		want     bool
+	}{
+		{"route matches route", entitySelector{RouteID: "r1"}, "r1", "", true},
+		{"route matches its stops", entitySelector{RouteID: "r1"}, "", "s1", true},
+		{"route does not match other route", entitySelector{RouteID: "r1"}, "r2", "", false},
+		{"stop matches stop", entitySelector{StopID: "s1"}, "", "s1", true},
+		{"stop does not match other stop", entitySelector{StopID: "s1"}, "", "s2", false},
+		{"route and stop match both", entitySelector{RouteID: "r1", StopID: "s1"}, "r1", "s1", true},
+		{"route and stop do not match other stop", entitySelector{RouteID: "r1", StopID: "s1"}, "r1", "s2", false},
+		{"trip route matches route", entitySelector{Trip: &tripDescriptor{TripID: "t1", RouteID: "r1"}}, "r1", "", true},
+		{"trip without route does not match", entitySelector{Trip: &tripDescriptor{TripID: "t1"}}, "r1", "", false},
+		{"agency does not match route", entitySelector{AgencyID: "a1"}, "r1", "", false},
+		{"agency does not match stop", entitySelector{AgencyID: "a1"}, "", "s1", false},
+		{"route type does not match route", entitySelector{RouteType: &busType}, "r1", "", false},
+		{"agency and route type do not match stop", entitySelector{AgencyID: "a1", RouteType: &busType}, "", "s1", false},
+		{"agency matches without filter", entitySelector{AgencyID: "a1"}, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &alert{InformedEntity: []entitySelector{tt.selector}}
+			if got := a.affects(tt.routeID, tt.stopID); got != tt.want {
+				t.Errorf("affects(%q, %q) = %v, want %v", tt.routeID, tt.stopID, got, tt.want)
+			}
+		})
+	}
+}
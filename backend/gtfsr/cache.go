@@ -0,0 +1,18 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/evanhearne/better_tfi/backend/httpcache"
+)
+
+// checkCached sets caching headers for a response built from data fetched
+// from upstream at fetchedAt, which stays current until the cache expires,
+// and reports whether the client already holds it.
+func checkCached(w http.ResponseWriter, r *http.Request, fetchedAt time.Time) bool {
+	etag := httpcache.ETag(strconv.FormatInt(fetchedAt.UnixNano(), 36))
+	maxAge := httpcache.MaxAge(time.Until(fetchedAt.Add(cfg.CacheTTL)))
+	return httpcache.Check(w.Header(), r, etag, fetchedAt, maxAge)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/evanhearne/better_tfi/backend/logging"
+)
+
+// Codes in the code field of error responses, matching the csv service.
+const (
+	codeInvalidParameter = "invalid_parameter"
+	codeInvalidRequest   = "invalid_request"
+	codeUnauthorized     = "unauthorized"
+	codeNotFound         = "not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeRateLimited      = "rate_limited"
+	codeUpstreamError    = "upstream_error"
+	codeInternalError    = "internal_error"
+)
+
+// apiError is the body of every error response.
+type apiError struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+func respondError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeJSON(w, status, apiError{
+		Code:      code,
+		Message:   message,
+		RequestID: requestID(r),
+	})
+}
+
+func requestID(r *http.Request) string {
+	return logging.RequestID(r.Context())
+}
+
+// allowGet responds 405 and reports false unless r is a GET request.
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet {
+		return true
+	}
+	w.Header().Set("Allow", http.MethodGet)
+	respondError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "only GET is supported")
+	return false
+}
+
+// upstreamError logs err and responds 502, as the NTA API, not this
+// service, failed.
+func upstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "upstream request failed", "error", err)
+	respondError(w, r, http.StatusBadGateway, codeUpstreamError, "the upstream feed is unavailable")
+}
+
+// internalError logs err and responds 500 with only a stable error code
+// and the request ID.
+func internalError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "request failed", "error", err)
+	respondError(w, r, http.StatusInternalServerError, codeInternalError, "internal server error")
+}
+
+func handleNotFound(w http.ResponseWriter, r *http.Request) {
+	respondError(w, r, http.StatusNotFound, codeNotFound, "no such endpoint")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/evanhearne/better_tfi/backend/logging"
+)
+
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+func TestErrorResponses(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	cfg = serviceConfig{
+		UpstreamURL: upstream.URL,
+		AlertsURL:   upstream.URL,
+		CacheTTL:    time.Minute,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gtfsr", handleGtfsr)
+	mux.HandleFunc("/alerts", handleAlerts)
+	mux.HandleFunc("/", handleNotFound)
+	handler := withRequestLogging(mux)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		code   string
+	}{
+		{"trip updates upstream failure", http.MethodGet, "/gtfsr", http.StatusBadGateway, codeUpstreamError},
+		{"alerts upstream failure", http.MethodGet, "/alerts", http.StatusBadGateway, codeUpstreamError},
+		{"unknown endpoint", http.MethodGet, "/no-such-endpoint", http.StatusNotFound, codeNotFound},
+		{"method not allowed", http.MethodPost, "/gtfsr", http.StatusMethodNotAllowed, codeMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set(logging.RequestIDHeader, "test-request")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+
+			var body apiError
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("error decoding body %q: %v", rec.Body.String(), err)
+			}
+
+			if body.Code != tt.code {
+				t.Errorf("code = %q, want %q", body.Code, tt.code)
+			}
+			if body.Message == "" {
+				t.Error("message is empty")
+			}
+			if body.RequestID != "test-request" {
+				t.Errorf("request_id = %q, want %q", body.RequestID, "test-request")
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// handleHealthz reports that the process is up. It never checks upstream,
+// so a slow or failing NTA API does not get the container restarted.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+}
+
+// handleReadyz reports whether the service can answer /gtfsr. It is unready
+// until the first successful upstream fetch, and afterwards when the last
+// fetch failed and the cache is older than max_stale. It reads the fetch
+// status without taking cacheMutex, so it answers while a fetch is in
+// progress.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	fetch := tripUpdatesStatus.load()
+	hasCache := !fetch.fetchedAt.IsZero()
+
+	status := map[string]interface{}{
+		"upstream_ok": hasCache && !fetch.failed,
+	}
+
+	if hasCache {
+		status["cache_updated_at"] = fetch.fetchedAt.UTC().Format(time.RFC3339)
+		status["cache_age_seconds"] = int(time.Since(fetch.fetchedAt).Seconds())
+	}
+
+	if fetch.lastError != nil {
+		status["last_upstream_error"] = fetch.lastError.Error()
+		status["last_upstream_error_at"] = fetch.errorAt.UTC().Format(time.RFC3339)
+	}
+
+	ready := hasCache && (!fetch.failed || time.Since(fetch.fetchedAt) < cfg.MaxStale)
+	if !ready {
+		status["status"] = "unavailable"
+		writeJSON(w, http.StatusServiceUnavailable, status)
+		return
+	}
+
+	status["status"] = "ok"
+	writeJSON(w, http.StatusOK, status)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/evanhearne/better_tfi/backend/access"
+)
+
+var (
+	// gate admits requests by API key or client IP, set up in main. Its
+	// zero value checks no keys and limits nothing.
+	gate           access.Gate
+	trustedProxies []*net.IPNet
+)
+
+// withRateLimit rejects requests without a valid API key when one is
+// required, and requests over the client's rate limit with 429. Health,
+// metrics and admin endpoints are not limited.
+func withRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if path == "/healthz" || path == "/readyz" || path == "/metrics" || strings.HasPrefix(path, "/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rejection, err := gate.Admit(r.Context(), r.Header.Get(access.APIKeyHeader), access.ClientIP(r, trustedProxies))
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+		if rejection != nil {
+			reject(w, r, rejection)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin rejects requests without the configured admin token as a
+// bearer token. The admin API is disabled when no token is configured.
+func requireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rejection := access.AuthorizeAdmin(r, cfg.AdminToken); rejection != nil {
+			reject(w, r, rejection)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// reject answers with a rejection decided on by the access package.
+func reject(w http.ResponseWriter, r *http.Request, rejection *access.Rejection) {
+	for name, values := range rejection.Header {
+		w.Header().Set(name, values[0])
+	}
+	if rejection.LimitedBy != "" {
+		rateLimited.WithLabelValues(rejection.LimitedBy).Inc()
+	}
+	writeJSON(w, rejection.Status, apiError{
+		Code:      rejection.Code,
+		Message:   rejection.Message,
+		Details:   rejection.Details,
+		RequestID: requestID(r),
+	})
+}
+
+// keysEnabled responds 404 and reports false when no keys database is
+// configured, as there are then no keys to manage.
+func keysEnabled(w http.ResponseWriter, r *http.Request) bool {
+	if gate.Keys != nil {
+		return true
+	}
+	respondError(w, r, http.StatusNotFound, codeNotFound, "API keys are disabled without keys_db_dsn")
+	return false
+}
+
+// handleListKeys handles GET /admin/keys, including revoked keys.
+func handleListKeys(w http.ResponseWriter, r *http.Request) {
+	if !keysEnabled(w, r) {
+		return
+	}
+
+	keys, err := gate.Keys.List(r.Context())
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+// handleCreateKey handles POST /admin/keys, issuing a key for the client
+// named in the body. The response is the only place the key appears.
+func handleCreateKey(w http.ResponseWriter, r *http.Request) {
+	if !keysEnabled(w, r) {
+		return
+	}
+
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || strings.TrimSpace(request.Name) == "" {
+		respondError(w, r, http.StatusBadRequest, codeInvalidRequest, "body must be a JSON object with a name")
+		return
+	}
+
+	created, err := gate.Keys.Create(r.Context(), strings.TrimSpace(request.Name))
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// handleRevokeKey handles POST /admin/keys/{key_id}/revoke. Revoked keys
+// are kept for reference.
+func handleRevokeKey(w http.ResponseWriter, r *http.Request) {
+	if !keysEnabled(w, r) {
+		return
+	}
+
+	keyID, err := strconv.Atoi(r.PathValue("key_id"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, codeInvalidParameter, "key_id must be an integer")
+		return
+	}
+
+	revoked, err := gate.Keys.Revoke(r.Context(), keyID)
+	if errors.Is(err, access.ErrKeyNotFound) {
+		respondError(w, r, http.StatusNotFound, codeNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, revoked)
+}
@@ -1,69 +1,343 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
 	"sync"
 	"time"
+
+	"github.com/evanhearne/better_tfi/backend/access"
+	"github.com/evanhearne/better_tfi/backend/compression"
+	"github.com/evanhearne/better_tfi/backend/config"
+	"github.com/evanhearne/better_tfi/backend/cors"
+	"github.com/evanhearne/better_tfi/backend/logging"
+	"github.com/evanhearne/better_tfi/backend/metrics"
+	"github.com/evanhearne/better_tfi/backend/server"
+	_ "github.com/lib/pq"
 )
 
 var (
 	cache          []byte
 	cacheTimestamp time.Time
-	cacheMutex     sync.Mutex
-	apiKey string 				// ldflag
+	// cache compressed with each content coding a client has asked for
+	// since the last refresh, so it is compressed at most once per refresh
+	// rather than per request
+	cacheCompressed map[string][]byte
+	cacheMutex      sync.Mutex
+	cfg             serviceConfig
+
+	// Outcome of trip updates fetches, kept apart from cacheMutex so /readyz
+	// and the metrics never wait behind a fetch in progress
+	tripUpdatesStatus feedStatus
+
+	// Client for the NTA API, with a timeout so a hung upstream fails the
+	// fetch rather than holding the cache lock
+	upstreamClient = &http.Client{}
 )
 
+type serviceConfig struct {
+	ListenAddr      string
+	APIKey          string
+	UpstreamURL     string
+	UpstreamTimeout time.Duration
+	CacheTTL        time.Duration
+	MaxStale        time.Duration
+	AlertsURL       string
+	AlertsFile      string
+	LogLevel        slog.Level
+
+	AdminToken         string // bearer token for the admin API, which is disabled if empty
+	KeysDatabaseDSN    string // database holding the api_keys table, keys are not checked if empty
+	InternalAPIKey     string // key the csv service calls with, exempt from rate limits
+	RequireAPIKey      bool
+	AnonymousRateLimit int // requests a minute per client IP, 0 for no limit
+	AnonymousBurst     int
+	KeyRateLimit       int // requests a minute per API key, 0 for no limit
+	KeyBurst           int
+	TrustedProxies     []*net.IPNet
+
+	CORS *cors.Policy // nil when no cross-origin requests are allowed
+
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+}
+
+// loadConfig reads the GTFSR_* environment variables, the file named by
+// -config or GTFSR_CONFIG, and command-line flags.
+func loadConfig(args []string) (serviceConfig, *config.Loader, error) {
+	loader := config.New("gtfsr", args)
+	listenAddr := loader.String("listen_addr", ":8080", "address to serve the API on")
+	apiKey := loader.String("api_key", "", "NTA developer API key", config.Required(), config.Secret())
+	upstreamURL := loader.URL("upstream_url", "https://api.nationaltransport.ie/gtfsr/v2/gtfsr", "GTFS-R trip updates feed")
+	upstreamTimeout := loader.Duration("upstream_timeout", 10*time.Second, "timeout for requests to the NTA API")
+	cacheTTL := loader.Duration("cache_ttl", 20*time.Second, "how long upstream responses are cached")
+	maxStale := loader.Duration("max_stale", 5*time.Minute, "cache age after which a failing upstream makes the service unready")
+	alertsURL := loader.URL("alerts_url", "", "GTFS-R service alerts feed (JSON)")
+	alertsFile := loader.String("alerts_file", "", "local JSON alerts used when alerts_url is unset")
+	logLevel := loader.String("log_level", "info", "minimum level logged: debug, info, warn or error")
+	adminToken := loader.String("admin_token", "", "bearer token for the admin API, disabled if empty", config.Secret())
+	keysDatabaseDSN := loader.String("keys_db_dsn", "", "PostgreSQL connection string of the csv database, whose api_keys table holds client API keys; keys are not checked if empty", config.Secret())
+	internalAPIKey := loader.String("internal_api_key", "", "API key the csv service calls with, exempt from rate limits", config.Secret())
+	requireAPIKey := loader.Bool("require_api_key", false, "reject requests without a valid X-API-Key header")
+	anonymousRateLimit := loader.Int("anonymous_rate_limit", 30, "requests a minute allowed per client IP without an API key, 0 for no limit")
+	anonymousBurst := loader.Int("anonymous_burst", 10, "requests a client IP may make at once")
+	keyRateLimit := loader.Int("key_rate_limit", 120, "requests a minute allowed per API key, 0 for no limit")
+	keyBurst := loader.Int("key_burst", 20, "requests an API key may make at once")
+	trustedProxies := loader.String("trusted_proxies", "", "comma-separated IPs or CIDR ranges of reverse proxies whose X-Forwarded-For is believed")
+	corsAllowedOrigins := loader.String("cors_allowed_origins", "", "comma-separated origins, such as https://app.example.com, allowed to call the API from a browser, or * for any")
+	corsAllowedMethods := loader.String("cors_allowed_methods", "GET", "comma-separated methods allowed in cross-origin requests")
+	corsMaxAge := loader.Duration("cors_max_age", 10*time.Minute, "how long browsers may cache a preflight response")
+	readTimeout := loader.Duration("read_timeout", 10*time.Second, "maximum time to read a request")
+	writeTimeout := loader.Duration("write_timeout", 30*time.Second, "maximum time to write a response")
+	idleTimeout := loader.Duration("idle_timeout", 60*time.Second, "how long idle keep-alive connections are kept")
+	shutdownTimeout := loader.Duration("shutdown_timeout", 20*time.Second, "how long in-flight requests may drain on shutdown")
+
+	if err := loader.Load(); err != nil {
+		return serviceConfig{}, nil, err
+	}
+
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		return serviceConfig{}, nil, fmt.Errorf("invalid gtfsr configuration: invalid log_level: %w", err)
+	}
+
+	if *requireAPIKey && *keysDatabaseDSN == "" {
+		return serviceConfig{}, nil, fmt.Errorf("invalid gtfsr configuration: require_api_key needs keys_db_dsn to check keys")
+	}
+
+	proxies, err := access.ParseProxies(*trustedProxies)
+	if err != nil {
+		return serviceConfig{}, nil, fmt.Errorf("invalid gtfsr configuration: invalid trusted_proxies: %w", err)
+	}
+
+	origins, err := cors.ParseOrigins(*corsAllowedOrigins)
+	if err != nil {
+		return serviceConfig{}, nil, fmt.Errorf("invalid gtfsr configuration: invalid cors_allowed_origins: %w", err)
+	}
+	methods, err := cors.ParseMethods(*corsAllowedMethods)
+	if err != nil {
+		return serviceConfig{}, nil, fmt.Errorf("invalid gtfsr configuration: invalid cors_allowed_methods: %w", err)
+	}
+
+	return serviceConfig{
+		ListenAddr:      *listenAddr,
+		APIKey:          *apiKey,
+		UpstreamURL:     *upstreamURL,
+		UpstreamTimeout: *upstreamTimeout,
+		CacheTTL:        *cacheTTL,
+		MaxStale:        *maxStale,
+		AlertsURL:       *alertsURL,
+		AlertsFile:      *alertsFile,
+		LogLevel:        level,
+
+		AdminToken:         *adminToken,
+		KeysDatabaseDSN:    *keysDatabaseDSN,
+		InternalAPIKey:     *internalAPIKey,
+		RequireAPIKey:      *requireAPIKey,
+		AnonymousRateLimit: *anonymousRateLimit,
+		AnonymousBurst:     *anonymousBurst,
+		KeyRateLimit:       *keyRateLimit,
+		KeyBurst:           *keyBurst,
+		TrustedProxies:     proxies,
+
+		CORS: cors.New(origins, methods, *corsMaxAge),
+
+		ReadTimeout:     *readTimeout,
+		WriteTimeout:    *writeTimeout,
+		IdleTimeout:     *idleTimeout,
+		ShutdownTimeout: *shutdownTimeout,
+	}, loader, nil
+}
+
 func main() {
-	// Start HTTP server
-	http.HandleFunc("/gtfsr", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
+	loadedConfig, loader, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		// -h printed the usage.
+		os.Exit(0)
+	}
+	if err != nil {
+		slog.Error("error loading configuration", "error", err)
+		os.Exit(1)
+	}
+	cfg = loadedConfig
+	slog.SetDefault(logging.New(os.Stdout, cfg.LogLevel))
+	slog.Info("configuration loaded", "settings", loader.Summary())
 
-		response, err := getCachedGtfsrData(apiKey)
+	gate = access.Gate{
+		Anonymous:   access.NewLimiter(cfg.AnonymousRateLimit, cfg.AnonymousBurst),
+		PerKey:      access.NewLimiter(cfg.KeyRateLimit, cfg.KeyBurst),
+		RequireKey:  cfg.RequireAPIKey,
+		InternalKey: cfg.InternalAPIKey,
+	}
+	if cfg.KeysDatabaseDSN != "" {
+		// The database is only needed for API keys; sql.Open does not
+		// connect, so the feed is served while it is down.
+		keysDB, err := sql.Open("postgres", cfg.KeysDatabaseDSN)
 		if err != nil {
-			http.Error(w, "Error fetching GTFSR data: "+err.Error(), http.StatusInternalServerError)
-			return
+			slog.Error("error opening the keys database", "error", err)
+			os.Exit(1)
 		}
+		gate.Keys = access.NewKeyStore(keysDB)
+	}
+	trustedProxies = cfg.TrustedProxies
+	upstreamClient.Timeout = cfg.UpstreamTimeout
 
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(response)
-	})
+	go warmCache()
 
-	fmt.Println("Server running on port 8080")
-	http.ListenAndServe(":8080", nil)
+	// Start HTTP server
+	http.HandleFunc("/gtfsr", instrument("/gtfsr", handleGtfsr))
+
+	http.HandleFunc("/alerts", instrument("/alerts", handleAlerts))
+	http.HandleFunc("/healthz", handleHealthz)
+	http.HandleFunc("/readyz", handleReadyz)
+	http.Handle("/metrics", metrics.Handler(registry))
+	http.HandleFunc("GET /admin/keys", requireAdmin(handleListKeys))
+	http.HandleFunc("POST /admin/keys", requireAdmin(handleCreateKey))
+	http.HandleFunc("POST /admin/keys/{key_id}/revoke", requireAdmin(handleRevokeKey))
+	http.HandleFunc("/", handleNotFound)
+
+	srv := &http.Server{
+		Addr:         cfg.ListenAddr,
+		Handler:      withRequestLogging(cfg.CORS.Handler(withRateLimit(compression.Handler(http.DefaultServeMux)))),
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+
+	if err := server.Run(srv, cfg.ShutdownTimeout); err != nil {
+		slog.Error("server error", "error", err)
+		os.Exit(1)
+	}
+}
+
+// handleGtfsr serves the trip updates feed from the cache, compressed when
+// the client accepts it.
+func handleGtfsr(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	response, fetchedAt, err := getCachedGtfsrData(cfg.APIKey)
+	if err != nil {
+		upstreamError(w, r, err)
+		return
+	}
+
+	if checkCached(w, r, fetchedAt) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	coding := compression.Negotiate(r.Header.Get("Accept-Encoding"))
+	compressed := getCompressedGtfsrData(coding, fetchedAt)
+
+	w.Header().Set("Content-Type", "application/json")
+	if compressed != nil {
+		w.Header().Set("Content-Encoding", coding)
+		compression.WeakETag(w.Header())
+		response = compressed
+	}
+	w.Write(response)
+}
+
+// getCachedGtfsrData returns the trip updates feed and when it was fetched
+// from upstream.
+func getCachedGtfsrData(apiKey string) ([]byte, time.Time, error) {
+	response, fetchedAt, fetched, err := refreshGtfsrData(apiKey)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if fetched {
+		// Read once per fetch, outside cacheMutex as it decodes the whole feed
+		feedTimestamp := parseFeedTimestamp(response)
+		tripUpdatesStatus.update(func(status *fetchStatus) {
+			if status.fetchedAt.Equal(fetchedAt) {
+				status.feedTimestamp = feedTimestamp
+			}
+		})
+	}
+	return response, fetchedAt, nil
 }
 
-func getCachedGtfsrData(apiKey string) ([]byte, error) {
+// refreshGtfsrData returns the cached trip updates feed, fetching it from
+// upstream first if the cache has expired. It reports whether it fetched.
+func refreshGtfsrData(apiKey string) ([]byte, time.Time, bool, error) {
 	cacheMutex.Lock()
 	defer cacheMutex.Unlock()
 
-	// Check if cache is valid (20 seconds TTL)
-	if time.Since(cacheTimestamp) < 20*time.Second && cache != nil {
-		return cache, nil
+	// Check if cache is valid
+	if time.Since(cacheTimestamp) < cfg.CacheTTL && cache != nil {
+		cacheRequests.WithLabelValues("trip_updates", "hit").Inc()
+		return cache, cacheTimestamp, false, nil
 	}
+	cacheRequests.WithLabelValues("trip_updates", "miss").Inc()
 
 	// Fetch new data
 	response, err := fetchGtfsrData(apiKey)
 	if err != nil {
-		return nil, err
+		tripUpdatesStatus.failed(err)
+		return nil, time.Time{}, false, err
 	}
 
 	// Update cache
 	cache = response
 	cacheTimestamp = time.Now()
+	tripUpdatesStatus.succeeded(cacheTimestamp)
+
+	cacheCompressed = map[string][]byte{}
+
+	return response, cacheTimestamp, true, nil
+}
 
-	return response, nil
+// getCompressedGtfsrData returns the feed fetched at fetchedAt compressed
+// with coding, or nil if it is not available that way. The feed is
+// compressed on the first request for each coding after a refresh.
+func getCompressedGtfsrData(coding string, fetchedAt time.Time) []byte {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	if coding == "" || !cacheTimestamp.Equal(fetchedAt) {
+		return nil
+	}
+	if compressed, ok := cacheCompressed[coding]; ok {
+		return compressed
+	}
+
+	compressed, err := compression.Encode(coding, cache)
+	if err != nil {
+		// Requests fall back to the uncompressed body.
+		slog.Error("error compressing feed", "coding", coding, "error", err)
+	}
+	cacheCompressed[coding] = compressed
+	return compressed
+}
+
+// warmCache fetches the trip updates feed at startup, so the service turns
+// ready without waiting for a client request, retrying every cache_ttl
+// until a fetch succeeds.
+func warmCache() {
+	for {
+		_, _, err := getCachedGtfsrData(cfg.APIKey)
+		if err == nil {
+			return
+		}
+		slog.Warn("error fetching trip updates at startup", "error", err)
+		time.Sleep(cfg.CacheTTL)
+	}
 }
 
 func fetchGtfsrData(apiKey string) ([]byte, error) {
-	rootURL := "https://api.nationaltransport.ie/gtfsr/v2/"
-	route := "gtfsr"
-	url := rootURL + route
-	client := &http.Client{}
+	url := cfg.UpstreamURL
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -73,7 +347,8 @@ func fetchGtfsrData(apiKey string) ([]byte, error) {
 	req.Header.Set("Cache-Control", "no-cache")
 	req.Header.Set("x-api-key", apiKey)
 
-	resp, err := client.Do(req)
+	resp, err := upstreamClient.Do(req)
+	recordUpstream("trip_updates", resp)
 	if err != nil {
 		return nil, fmt.Errorf("error making HTTP request: %w", err)
 	}
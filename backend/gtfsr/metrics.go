@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/evanhearne/better_tfi/backend/gtfsrjson"
+	"github.com/evanhearne/better_tfi/backend/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	registry = metrics.NewRegistry()
+	factory  = promauto.With(registry)
+
+	requestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+	cacheRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "gtfsr_cache_requests_total",
+		Help: "Feed lookups by cache and whether they were served from the cache.",
+	}, []string{"cache", "result"})
+	rateLimited = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_rate_limited_total",
+		Help: "Requests rejected with 429, by whether the client was identified by API key or IP.",
+	}, []string{"client"})
+	upstreamResponses = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "gtfsr_upstream_responses_total",
+		Help: "Requests to the NTA API by feed and status code, or \"error\" if no response was received.",
+	}, []string{"feed", "code"})
+)
+
+// The gauges read the fetch status rather than the caches, so a scrape
+// never waits behind an upstream fetch.
+func init() {
+	registry.MustRegister(
+		metrics.NewOptionalGaugeFunc(prometheus.GaugeOpts{
+			Name: "gtfsr_trip_updates_cache_age_seconds",
+			Help: "Seconds since the trip updates cache was refreshed.",
+		}, func() (float64, bool) {
+			return age(tripUpdatesStatus.load().fetchedAt)
+		}),
+		metrics.NewOptionalGaugeFunc(prometheus.GaugeOpts{
+			Name: "gtfsr_alerts_cache_age_seconds",
+			Help: "Seconds since the alerts cache was refreshed.",
+		}, func() (float64, bool) {
+			return age(alertsStatus.load().fetchedAt)
+		}),
+		metrics.NewOptionalGaugeFunc(prometheus.GaugeOpts{
+			Name: "gtfsr_feed_age_seconds",
+			Help: "Seconds since the cached trip updates feed was generated upstream.",
+		}, func() (float64, bool) {
+			return age(tripUpdatesStatus.load().feedTimestamp)
+		}),
+	)
+}
+
+// age returns the seconds since t, and false if t is unset.
+func age(t time.Time) (float64, bool) {
+	return time.Since(t).Seconds(), !t.IsZero()
+}
+
+// instrument records the latency and status code of every request to
+// handler under route, the path it is served on.
+func instrument(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler(recorder, r)
+		requestDuration.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Observe(time.Since(start).Seconds())
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// recordUpstream counts a response, or a failed request when resp is nil,
+// from the NTA API.
+func recordUpstream(feed string, resp *http.Response) {
+	if resp == nil {
+		upstreamResponses.WithLabelValues(feed, "error").Inc()
+		return
+	}
+	upstreamResponses.WithLabelValues(feed, strconv.Itoa(resp.StatusCode)).Inc()
+}
+
+// parseFeedTimestamp reads the header timestamp of a GTFS-R JSON feed.
+func parseFeedTimestamp(body []byte) time.Time {
+	var feed struct {
+		Header struct {
+			Timestamp gtfsrjson.Int `json:"timestamp"`
+		} `json:"header"`
+	}
+	if err := json.Unmarshal(body, &feed); err != nil || feed.Header.Timestamp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(feed.Header.Timestamp), 0)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/evanhearne/better_tfi/backend/logging"
+)
+
+// withRequestLogging gives every request an ID, taken from the X-Request-ID
+// header when the csv service or a proxy set one, carries it in the request
+// context and logs the request once it has been served.
+func withRequestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := logging.EnsureRequestID(r.Header.Get(logging.RequestIDHeader))
+		r = r.WithContext(logging.WithRequestID(r.Context(), id))
+		w.Header().Set(logging.RequestIDHeader, id)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				slog.ErrorContext(r.Context(), "panic serving request", "panic", recovered, "stack", string(debug.Stack()))
+				respondError(recorder, r, http.StatusInternalServerError, codeInternalError, "internal server error")
+			}
+
+			slog.InfoContext(r.Context(), "request served",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", recorder.status,
+				"duration_ms", time.Since(start).Milliseconds(),
+				"remote_addr", r.RemoteAddr,
+			)
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
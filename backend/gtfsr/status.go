@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fetchStatus is the outcome of upstream fetches of a feed.
+type fetchStatus struct {
+	fetchedAt     time.Time // last successful fetch, zero before the first
+	feedTimestamp time.Time // when upstream generated the fetched feed, if it says
+	failed        bool      // whether the most recent fetch failed
+	lastError     error
+	errorAt       time.Time
+}
+
+// feedStatus holds the fetchStatus of a feed. Updates replace it as a
+// whole, so it is read without a lock and readers never see a partial
+// update.
+type feedStatus struct {
+	mu      sync.Mutex // serializes updates
+	current atomic.Pointer[fetchStatus]
+}
+
+// load returns a copy of the current status.
+func (s *feedStatus) load() fetchStatus {
+	if current := s.current.Load(); current != nil {
+		return *current
+	}
+	return fetchStatus{}
+}
+
+// update applies change to a copy of the current status and publishes it.
+func (s *feedStatus) update(change func(*fetchStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.load()
+	change(&status)
+	s.current.Store(&status)
+}
+
+// succeeded records a successful fetch at fetchedAt.
+func (s *feedStatus) succeeded(fetchedAt time.Time) {
+	s.update(func(status *fetchStatus) {
+		status.fetchedAt = fetchedAt
+		status.feedTimestamp = time.Time{}
+		status.failed = false
+	})
+}
+
+// failed records a fetch that failed with err.
+func (s *feedStatus) failed(err error) {
+	s.update(func(status *fetchStatus) {
+		status.failed = true
+		status.lastError = err
+		status.errorAt = time.Now()
+	})
+}
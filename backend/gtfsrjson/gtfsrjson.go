@@ -0,0 +1,25 @@
+// Package gtfsrjson holds types for decoding the GTFS-Realtime JSON
+// encoding used by the NTA feeds and the gtfsr service.
+package gtfsrjson
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// Int decodes integers the feed sends either as JSON numbers or as quoted
+// strings (64-bit fields such as timestamps are quoted).
+type Int int64
+
+func (i *Int) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	v, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = Int(v)
+	return nil
+}
@@ -0,0 +1,3 @@
+module github.com/evanhearne/better_tfi/backend/httpcache
+
+go 1.23.2
@@ -0,0 +1,68 @@
+// Package httpcache sets the caching headers of the backend services'
+// responses and evaluates conditional requests against them, so clients
+// and CDNs can reuse responses that have not changed.
+package httpcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ETag returns a strong entity tag built from parts, which must not contain
+// double quotes.
+func ETag(parts ...string) string {
+	return `"` + strings.Join(parts, "-") + `"`
+}
+
+// MaxAge returns a Cache-Control value letting any cache reuse the
+// response for d, rounded down to whole seconds.
+func MaxAge(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return "public, max-age=" + strconv.Itoa(int(d/time.Second))
+}
+
+// Revalidate is a Cache-Control value letting caches store the response
+// but requiring them to check it is current before each reuse.
+const Revalidate = "public, no-cache"
+
+// Check sets ETag, Last-Modified (unless lastModified is zero) and
+// Cache-Control on h, and reports whether the conditional headers of r show
+// the client already holds this response. The caller should then answer
+// 304 Not Modified without a body.
+func Check(h http.Header, r *http.Request, etag string, lastModified time.Time, cacheControl string) bool {
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", cacheControl)
+	if !lastModified.IsZero() {
+		h.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since (RFC 9110 13.2.2).
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return matchesETag(inm, etag)
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !lastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// matchesETag applies the weak comparison If-None-Match calls for.
+func matchesETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
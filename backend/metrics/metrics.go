@@ -0,0 +1,52 @@
+// Package metrics holds the Prometheus helpers shared by the backend
+// services, on top of the Prometheus client library.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// NewRegistry returns a registry holding the Go runtime and process
+// metrics, for a service to register its own metrics with.
+func NewRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
+
+// Handler serves the metrics in registry.
+func Handler(registry *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// NewOptionalGaugeFunc returns a gauge that calls value on each scrape. The
+// gauge is left out of the scrape while value reports false, for readings
+// such as the age of a cache that has not been filled yet.
+func NewOptionalGaugeFunc(opts prometheus.GaugeOpts, value func() (float64, bool)) prometheus.Collector {
+	return &optionalGauge{
+		desc:  prometheus.NewDesc(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), opts.Help, nil, opts.ConstLabels),
+		value: value,
+	}
+}
+
+type optionalGauge struct {
+	desc  *prometheus.Desc
+	value func() (float64, bool)
+}
+
+func (g *optionalGauge) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.desc
+}
+
+func (g *optionalGauge) Collect(ch chan<- prometheus.Metric) {
+	if value, ok := g.value(); ok {
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, value)
+	}
+}
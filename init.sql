@@ -65,6 +65,39 @@ FROM staging_stops;
 
 DROP TABLE staging_stops;
 
+-- Loads a GTFS file into an existing table, matching columns by the
+-- file's header rather than by position. Optional fields such as
+-- shape_dist_traveled are loaded when the feed has them and left NULL
+-- otherwise; fields the table has no column for are ignored.
+CREATE FUNCTION load_gtfs_file(target TEXT, path TEXT) RETURNS VOID AS $$
+DECLARE
+    first_bytes BYTEA;
+    header TEXT[];
+    target_columns TEXT;
+    staged_values TEXT;
+BEGIN
+    first_bytes := pg_read_binary_file(path, 0, 8192);
+    SELECT array_agg(trim(BOTH E' "\r\uFEFF' FROM name) ORDER BY n)
+    INTO header
+    FROM unnest(string_to_array(
+        convert_from(substring(first_bytes FROM 1 FOR position('\x0a'::BYTEA IN first_bytes) - 1), 'UTF8'),
+        ',')) WITH ORDINALITY AS h(name, n);
+
+    EXECUTE format('CREATE TEMP TABLE gtfs_staging (%s)',
+        (SELECT string_agg(format('%I TEXT', name), ', ' ORDER BY n) FROM unnest(header) WITH ORDINALITY AS h(name, n)));
+    EXECUTE format('COPY gtfs_staging FROM %L DELIMITER '','' CSV HEADER', path);
+
+    SELECT string_agg(format('%I', column_name), ', ' ORDER BY ordinal_position),
+        string_agg(format('nullif(%I, '''')::%s', column_name, data_type), ', ' ORDER BY ordinal_position)
+    INTO target_columns, staged_values
+    FROM information_schema.columns
+    WHERE table_schema = current_schema() AND table_name = target AND column_name = ANY(header);
+
+    EXECUTE format('INSERT INTO %I (%s) SELECT %s FROM gtfs_staging', target, target_columns, staged_values);
+    DROP TABLE gtfs_staging;
+END
+$$ LANGUAGE plpgsql;
+
 CREATE TABLE trips (
     route_id TEXT,
     service_id TEXT,
@@ -73,13 +106,12 @@ CREATE TABLE trips (
     trip_short_name TEXT,
     direction_id INTEGER,
     block_id TEXT,
-    shape_id TEXT
+    shape_id TEXT,
+    wheelchair_accessible INTEGER,
+    bikes_allowed INTEGER
 );
 
-COPY trips(route_id, service_id, trip_id, trip_headsign, trip_short_name, direction_id, block_id, shape_id)
-FROM '/data/trips.txt'
-DELIMITER ','
-CSV HEADER;
+SELECT load_gtfs_file('trips', '/data/trips.txt');
 
 CREATE INDEX idx_route_id ON trips(route_id);
 CREATE INDEX idx_trip_id_trips ON trips(trip_id);
@@ -133,12 +165,119 @@ CREATE TABLE stops (
     zone_id TEXT,
     stop_url TEXT,
     location_type INTEGER,
-    parent_station TEXT
+    parent_station TEXT,
+    wheelchair_boarding INTEGER
 );
 
-COPY stops(stop_id, stop_code, stop_name, stop_desc, stop_lat, stop_lon, zone_id, stop_url, location_type, parent_station)
-FROM '/data/stops.txt'
-DELIMITER ','
-CSV HEADER;
+SELECT load_gtfs_file('stops', '/data/stops.txt');
+
+CREATE INDEX idx_stop_id_stops ON stops(stop_id);
+CREATE INDEX idx_parent_station_stops ON stops(parent_station);
+
+CREATE TABLE agency (
+    agency_id TEXT,
+    agency_name TEXT,
+    agency_url TEXT,
+    agency_timezone TEXT
+);
+
+SELECT load_gtfs_file('agency', '/data/agency.txt');
+
+CREATE INDEX idx_agency_id_agency ON agency(agency_id);
+CREATE INDEX idx_agency_id_routes ON routes(agency_id);
+
+-- Distinct routes calling at each stop, used to filter stops by agency and
+-- route type without scanning stop_times.
+CREATE TABLE stop_routes AS
+SELECT DISTINCT s.stop_id, t.route_id
+FROM stop_times s
+JOIN trips t ON s.trip_id = t.trip_id;
 
-CREATE INDEX idx_stop_id_stops ON stops(stop_id);
\ No newline at end of file
+CREATE INDEX idx_stop_id_stop_routes ON stop_routes(stop_id);
+
+CREATE TABLE shapes (
+    shape_id TEXT,
+    shape_pt_lat REAL,
+    shape_pt_lon REAL,
+    shape_pt_sequence INTEGER,
+    shape_dist_traveled REAL
+);
+
+SELECT load_gtfs_file('shapes', '/data/shapes.txt');
+
+CREATE INDEX idx_shape_id_shapes ON shapes(shape_id, shape_pt_sequence);
+CREATE INDEX idx_shape_id_trips ON trips(shape_id);
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- Folds a stop name or search query into a comparable form: lower case,
+-- accents and apostrophes removed, punctuation collapsed to single spaces
+-- and common abbreviations expanded (St -> Street, Stn -> Station, ...).
+-- A leading St is left alone, as it is usually Saint (St Stephen's Green).
+CREATE FUNCTION normalize_search_text(input TEXT) RETURNS TEXT AS $$
+    SELECT trim(regexp_replace(
+        regexp_replace(regexp_replace(regexp_replace(regexp_replace(
+        regexp_replace(regexp_replace(regexp_replace(regexp_replace(
+        regexp_replace(regexp_replace(
+            regexp_replace(
+                regexp_replace(lower(public.unaccent('public.unaccent', coalesce(input, ''))), '[''`’‘]', '', 'g'),
+                '[^a-z0-9]+', ' ', 'g'),
+            '([a-z0-9]) st\M', '\1 street', 'g'),
+            '\mstn\M', 'station', 'g'),
+            '\mrd\M', 'road', 'g'),
+            '\mave?\M', 'avenue', 'g'),
+            '\msq\M', 'square', 'g'),
+            '\mtce\M', 'terrace', 'g'),
+            '\mpk\M', 'park', 'g'),
+            '\mdr\M', 'drive', 'g'),
+            '\mopp\M', 'opposite', 'g'),
+            '\mctr\M', 'centre', 'g'),
+        '\s+', ' ', 'g'))
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE stops ADD COLUMN search_name TEXT;
+UPDATE stops SET search_name = normalize_search_text(stop_name);
+
+CREATE INDEX idx_stops_search_name_trgm ON stops USING gin (search_name gin_trgm_ops);
+CREATE INDEX idx_stops_stop_code ON stops(stop_code);
+
+-- Alerts written by operators through the csv service's admin API, merged
+-- with the official GTFS-R alerts.
+CREATE TABLE custom_alerts (
+    alert_id SERIAL PRIMARY KEY,
+    header_text TEXT NOT NULL,
+    description_text TEXT,
+    url TEXT,
+    cause TEXT,
+    effect TEXT,
+    route_ids TEXT[] NOT NULL DEFAULT '{}',
+    stop_ids TEXT[] NOT NULL DEFAULT '{}',
+    active_start TIMESTAMPTZ,
+    active_end TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Identifies the static feed this database was loaded from. The version
+-- changes on every load and is reported by the csv service's /readyz.
+CREATE TABLE feed_info (
+    feed_version TEXT NOT NULL,
+    feed_start_date DATE,
+    feed_end_date DATE,
+    loaded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO feed_info (feed_version, feed_start_date, feed_end_date)
+SELECT to_char(now(), 'YYYYMMDDHH24MISS'), min(start_date), max(end_date)
+FROM calendar;
+
+-- Client API keys issued through the csv service's admin API. Only a hash
+-- of each key is stored.
+CREATE TABLE api_keys (
+    key_id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);